@@ -0,0 +1,253 @@
+// Command balancebench compares two ways of computing a group's balances:
+// loading the splits of every expense one query at a time (the original N+1
+// approach) and the single BalanceTotals query.
+//
+// By default it runs on a seeded in-memory dataset, where each repository
+// call is delayed by -latency to stand in for a network round trip to the
+// database. With -mongo it seeds a throwaway database on that server instead,
+// so the $facet/$lookup aggregation is timed for real; the database is
+// dropped afterwards.
+//
+//	go run ./cmd/balancebench -expenses 2000 -members 8 -latency 2ms
+//	go run ./cmd/balancebench -expenses 2000 -mongo "mongodb://localhost:27017/?replicaSet=rs0"
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand"
+	"time"
+
+	"expensetracker/models"
+	"expensetracker/repository"
+	"expensetracker/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	expenseCount := flag.Int("expenses", 2000, "number of expenses to seed")
+	memberCount := flag.Int("members", 8, "number of group members")
+	latency := flag.Duration("latency", 2*time.Millisecond, "simulated round trip per repository call (in-memory only)")
+	mongoURI := flag.String("mongo", "", "MongoDB connection string; seeds and queries a temporary database there")
+	runs := flag.Int("runs", 3, "times each approach is run; the fastest run is reported")
+	flag.Parse()
+
+	if err := bench(*mongoURI, *expenseCount, *memberCount, *latency, *runs); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func bench(mongoURI string, expenseCount, memberCount int, latency time.Duration, runs int) error {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	backend := fmt.Sprintf("in memory, %s per simulated round trip", latency)
+	if mongoURI != "" {
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+		if err != nil {
+			return fmt.Errorf("connecting to MongoDB: %w", err)
+		}
+		defer client.Disconnect(ctx)
+
+		db := client.Database("balancebench_" + primitive.NewObjectID().Hex())
+		defer db.Drop(ctx)
+		if err := repository.EnsureMongoDatabaseIndexes(ctx, db); err != nil {
+			return fmt.Errorf("creating indexes: %w", err)
+		}
+		store = repository.NewMongoDatabaseStore(db)
+		backend, latency = "on MongoDB database "+db.Name(), 0
+	}
+
+	groupID, err := seed(ctx, store, expenseCount, memberCount)
+	if err != nil {
+		return fmt.Errorf("seeding failed: %w", err)
+	}
+
+	remote := &slowStore{latency: latency}
+	remote.expenses = &slowExpenses{ExpenseRepository: store.Expenses, store: remote}
+	remote.splits = &slowSplits{SplitRepository: store.Splits, store: remote}
+
+	perExpense, perExpenseCalls, perExpenseTime, err := run(remote, runs, func() (services.Balances, error) {
+		return balancesPerExpense(ctx, remote, groupID)
+	})
+	if err != nil {
+		return err
+	}
+	aggregated, aggregatedCalls, aggregatedTime, err := run(remote, runs, func() (services.Balances, error) {
+		return balancesAggregated(ctx, remote, groupID)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d expenses, %d members, %s, fastest of %d runs\n", expenseCount, memberCount, backend, runs)
+	fmt.Printf("%-22s %8s %12s\n", "approach", "queries", "time")
+	fmt.Printf("%-22s %8d %12s\n", "split query/expense", perExpenseCalls, perExpenseTime.Round(time.Microsecond))
+	fmt.Printf("%-22s %8d %12s\n", "BalanceTotals", aggregatedCalls, aggregatedTime.Round(time.Microsecond))
+	if !maps.Equal(perExpense, aggregated) {
+		return fmt.Errorf("the two approaches computed different balances")
+	}
+	fmt.Println("balances match")
+	return nil
+}
+
+// run times compute runs times and counts the repository calls it makes,
+// returning the result and duration of the fastest run
+func run(store *slowStore, runs int, compute func() (services.Balances, error)) (services.Balances, int, time.Duration, error) {
+	var balances services.Balances
+	var fastest time.Duration
+	for i := 0; i < max(runs, 1); i++ {
+		store.calls = 0
+		start := time.Now()
+		result, err := compute()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if elapsed := time.Since(start); i == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+		balances = result
+	}
+	return balances, store.calls, fastest, nil
+}
+
+// balancesPerExpense is how GetSettlements used to compute balances
+func balancesPerExpense(ctx context.Context, store *slowStore, groupID primitive.ObjectID) (services.Balances, error) {
+	balances := services.Balances{}
+	expenses, err := store.expenses.FindByGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	for _, expense := range expenses {
+		splits, err := store.splits.FindByExpense(ctx, expense.ID)
+		if err != nil {
+			return nil, err
+		}
+		balances.ApplyExpense(expense, splits)
+	}
+	return balances, nil
+}
+
+func balancesAggregated(ctx context.Context, store *slowStore, groupID primitive.ObjectID) (services.Balances, error) {
+	totals, err := store.expenses.BalanceTotals(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	balances := services.Balances{}
+	balances.ApplyTotals(totals)
+	return balances, nil
+}
+
+// seed creates a group with random expenses split equally between a random
+// subset of members. Every fifth expense is in USD with several payers. The
+// expenses and splits are written in one batch each.
+func seed(ctx context.Context, store *repository.Store, expenseCount, memberCount int) (primitive.ObjectID, error) {
+	rng := rand.New(rand.NewSource(1))
+	members := make([]primitive.ObjectID, memberCount)
+	for i := range members {
+		members[i] = primitive.NewObjectID()
+	}
+	group := models.Group{ID: primitive.NewObjectID(), Name: "Benchmark", BaseCurrency: "INR", CreatedBy: members[0], Members: members, CreatedAt: time.Now()}
+	if err := store.Groups.Create(ctx, &group); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	var expenses []models.Expense
+	var allSplits []models.Split
+	for i := 0; i < expenseCount; i++ {
+		amount := models.Money(100 + rng.Int63n(1000000))
+		expense := models.Expense{
+			ID:          primitive.NewObjectID(),
+			GroupID:     group.ID,
+			PaidBy:      members[rng.Intn(memberCount)],
+			Amount:      amount,
+			Currency:    "INR",
+			Description: fmt.Sprintf("Expense %d", i),
+			SplitType:   services.SplitEqual,
+			Date:        time.Now(),
+			CreatedAt:   time.Now(),
+		}
+		if i%5 == 0 {
+			expense.Currency = "USD"
+			first, second := members[0], members[1%memberCount]
+			expense.Payers = []models.PayerContribution{{UserID: first, Amount: amount / 2}, {UserID: second, Amount: amount - amount/2}}
+			expense.PaidBy = second
+		}
+
+		var participants []services.SplitInput
+		for _, member := range members {
+			if rng.Intn(3) > 0 || len(participants) == 0 {
+				participants = append(participants, services.SplitInput{UserID: member.Hex()})
+			}
+		}
+		results, err := services.CalculateSplits(services.SplitEqual, amount, participants)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		splits := make([]models.Split, len(results))
+		for j, result := range results {
+			userID, _ := primitive.ObjectIDFromHex(result.UserID)
+			splits[j] = models.Split{ID: primitive.NewObjectID(), ExpenseID: expense.ID, UserID: userID, Amount: result.Amount}
+		}
+
+		rate := 1.0
+		if expense.Currency == "USD" {
+			rate = 83.25
+		}
+		if err := services.ConvertExpense(&expense, splits, rate); err != nil {
+			return primitive.NilObjectID, err
+		}
+		expenses = append(expenses, expense)
+		allSplits = append(allSplits, splits...)
+	}
+	if err := store.Expenses.CreateMany(ctx, expenses); err != nil {
+		return primitive.NilObjectID, err
+	}
+	if err := store.Splits.CreateMany(ctx, allSplits); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return group.ID, nil
+}
+
+// slowStore delays and counts the repository calls the benchmark makes
+type slowStore struct {
+	latency  time.Duration
+	calls    int
+	expenses repository.ExpenseRepository
+	splits   repository.SplitRepository
+}
+
+func (s *slowStore) roundTrip() {
+	s.calls++
+	time.Sleep(s.latency)
+}
+
+type slowExpenses struct {
+	repository.ExpenseRepository
+	store *slowStore
+}
+
+func (r *slowExpenses) FindByGroup(ctx context.Context, groupID primitive.ObjectID) ([]models.Expense, error) {
+	r.store.roundTrip()
+	return r.ExpenseRepository.FindByGroup(ctx, groupID)
+}
+
+func (r *slowExpenses) BalanceTotals(ctx context.Context, groupID primitive.ObjectID) ([]models.UserTotals, error) {
+	r.store.roundTrip()
+	return r.ExpenseRepository.BalanceTotals(ctx, groupID)
+}
+
+type slowSplits struct {
+	repository.SplitRepository
+	store *slowStore
+}
+
+func (r *slowSplits) FindByExpense(ctx context.Context, expenseID primitive.ObjectID) ([]models.Split, error) {
+	r.store.roundTrip()
+	return r.SplitRepository.FindByExpense(ctx, expenseID)
+}
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// IsSystemAdmin reports whether userID is listed in ADMIN_USER_IDS, a comma
+// separated list of user IDs allowed to change data shared by every group
+func IsSystemAdmin(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	for _, adminID := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if strings.TrimSpace(adminID) == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -40,12 +40,3 @@ func ConnectDB() {
 	fmt.Println("Connected to MongoDB Atlas!")
 	DB = client
 }
-
-// GetCollection returns a mongo collection
-func GetCollection(collectionName string) *mongo.Collection {
-	if DB == nil {
-		log.Println("Warning: Attempted to get collection but DB is nil")
-		return nil
-	}
-	return DB.Database("expensetracker").Collection(collectionName)
-}
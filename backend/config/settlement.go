@@ -0,0 +1,23 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+const (
+	defaultExactSettlementMaxSize = 15
+	// The exact solver needs memory for every subset of people: 2^20 subsets
+	// already take about 10 MB, so larger values are capped
+	maxExactSettlementMaxSize = 20
+)
+
+// ExactSettlementMaxSize returns the largest number of people with an open
+// balance the exact settlement solver handles, from SETTLEMENT_EXACT_MAX_SIZE
+func ExactSettlementMaxSize() int {
+	size, err := strconv.Atoi(os.Getenv("SETTLEMENT_EXACT_MAX_SIZE"))
+	if err != nil || size < 0 {
+		return defaultExactSettlementMaxSize
+	}
+	return min(size, maxExactSettlementMaxSize)
+}
@@ -2,15 +2,16 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
-	"expensetracker/config"
 	"expensetracker/models"
+	"expensetracker/repository"
 	"expensetracker/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -22,17 +23,22 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	collection := config.GetCollection("users")
+	email := normalizeEmail(req.Email)
+
+	store := repository.Get()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Check if email exists
-	var existingUser models.User
-	err := collection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&existingUser)
+	_, err := store.Users.FindByEmail(ctx, email)
 	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
 		return
 	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email"})
+		return
+	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -44,21 +50,48 @@ func Register(c *gin.Context) {
 	newUser := models.User{
 		ID:        primitive.NewObjectID(),
 		Name:      req.Name,
-		Email:     req.Email,
+		Email:     email,
 		Password:  string(hashedPassword),
 		Groups:    []primitive.ObjectID{},
 		CreatedAt: time.Now(),
 	}
 
-	_, err = collection.InsertOne(ctx, newUser)
+	// Create the user and join every group they were invited to
+	joinedGroups := []string{}
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		joinedGroups = joinedGroups[:0]
+		if err := store.Users.Create(ctx, &newUser); err != nil {
+			return err
+		}
+
+		invitations, err := store.Invitations.FindPendingByEmail(ctx, newUser.Email, time.Now())
+		if err != nil {
+			return err
+		}
+		for _, invitation := range invitations {
+			group, err := store.Groups.FindByID(ctx, invitation.GroupID)
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := acceptInvitation(ctx, group, &invitation, newUser.ID); err != nil {
+				return err
+			}
+			joinedGroups = append(joinedGroups, group.ID.Hex())
+		}
+		return nil
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
-		"userId":  newUser.ID.Hex(),
+		"message":      "User registered successfully",
+		"userId":       newUser.ID.Hex(),
+		"joinedGroups": joinedGroups,
 	})
 }
 
@@ -69,12 +102,10 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	collection := config.GetCollection("users")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var user models.User
-	err := collection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
+	user, err := repository.Get().Users.FindByEmail(ctx, normalizeEmail(req.Email))
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
@@ -86,19 +117,164 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.ID.Hex())
+	tokens, _, err := issueTokens(ctx, user.ID, primitive.NewObjectID())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "Login successful",
-		"token":   token,
 		"user": gin.H{
 			"id":    user.ID.Hex(),
 			"name":  user.Name,
 			"email": user.Email,
 		},
+	}
+	for key, value := range tokens {
+		response[key] = value
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RefreshToken exchanges a refresh token for a new access/refresh token pair.
+// The presented refresh token is rotated out; presenting it again afterwards
+// is treated as theft and revokes every token issued from the same login.
+func RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	store := repository.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	existing, err := store.Tokens.FindRefreshToken(ctx, utils.HashToken(req.RefreshToken))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	now := time.Now()
+	if existing.RevokedAt != nil {
+		if err := store.Tokens.RevokeRefreshFamily(ctx, existing.FamilyID, now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used"})
+		return
+	}
+	if now.After(existing.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has expired"})
+		return
+	}
+
+	var tokens gin.H
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		var replacedBy primitive.ObjectID
+		tokens, replacedBy, err = issueTokens(ctx, existing.UserID, existing.FamilyID)
+		if err != nil {
+			return err
+		}
+		return store.Tokens.RevokeRefreshToken(ctx, existing.ID, &replacedBy, now)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		// Lost a race with another refresh using the same token
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	tokens["message"] = "Token refreshed"
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout revokes the access token used for the request and, when given, the
+// refresh token (and with it every token of the same login)
+func Logout(c *gin.Context) {
+	var req models.LogoutRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	store := repository.Get()
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userID"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	err := store.WithTransaction(ctx, func(ctx context.Context) error {
+		err := store.Tokens.RevokeAccessToken(ctx, &models.RevokedToken{
+			ID:        primitive.NewObjectID(),
+			TokenID:   c.GetString("tokenID"),
+			UserID:    userID,
+			ExpiresAt: c.GetTime("tokenExpiry"),
+			RevokedAt: now,
+		})
+		if err != nil || req.RefreshToken == "" {
+			return err
+		}
+
+		refresh, err := store.Tokens.FindRefreshToken(ctx, utils.HashToken(req.RefreshToken))
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && refresh.UserID != userID) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return store.Tokens.RevokeRefreshFamily(ctx, refresh.FamilyID, now)
 	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// issueTokens creates an access token and a stored refresh token belonging to
+// the given token family. It returns the response fields and the ID of the
+// stored refresh token.
+func issueTokens(ctx context.Context, userID, familyID primitive.ObjectID) (gin.H, primitive.ObjectID, error) {
+	accessToken, _, expiresAt, err := utils.GenerateJWT(userID.Hex())
+	if err != nil {
+		return nil, primitive.NilObjectID, err
+	}
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, primitive.NilObjectID, err
+	}
+
+	now := time.Now()
+	record := models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: now.Add(utils.RefreshTokenTTL),
+		CreatedAt: now,
+	}
+	if err := repository.Get().Tokens.CreateRefreshToken(ctx, &record); err != nil {
+		return nil, primitive.NilObjectID, err
+	}
+
+	return gin.H{
+		"token":        accessToken,
+		"expiresIn":    int(time.Until(expiresAt).Seconds()),
+		"refreshToken": refreshToken,
+	}, record.ID, nil
+}
+
+// normalizeEmail trims and lower-cases an email address, the form in which
+// users and invitations are stored and looked up
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"expensetracker/models"
+	"expensetracker/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCategories lists the categories expenses of the group can use
+func GetCategories(c *gin.Context) {
+	group := groupFromContext(c)
+
+	custom := group.CustomCategories
+	if custom == nil {
+		custom = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"categories": group.CategoryCatalogue(),
+		"defaults":   models.DefaultCategories,
+		"custom":     custom,
+	})
+}
+
+// AddCategory adds a custom category to the group's catalogue (admin)
+func AddCategory(c *gin.Context) {
+	group := groupFromContext(c)
+
+	var req models.AddCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category := normalizeCategory(req.Name)
+	if category == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category name cannot be empty"})
+		return
+	}
+	if group.HasCategory(category) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category already exists"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := repository.Get().Groups.AddCategory(ctx, group.ID, category); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add category"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Category added successfully",
+		"category": category,
+	})
+}
+
+// RemoveCategory removes a custom category from the group's catalogue
+// (admin). Expenses already using it keep it.
+func RemoveCategory(c *gin.Context) {
+	group := groupFromContext(c)
+
+	category := normalizeCategory(c.Param("name"))
+	if slices.Contains(models.DefaultCategories, category) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Default categories cannot be removed"})
+		return
+	}
+	if !slices.Contains(group.CustomCategories, category) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := repository.Get().Groups.RemoveCategory(ctx, group.ID, category); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category removed successfully"})
+}
@@ -2,14 +2,19 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
-	"expensetracker/config"
 	"expensetracker/models"
+	"expensetracker/repository"
+	"expensetracker/services"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -41,64 +46,106 @@ func AddExpense(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	store := repository.Get()
+
 	// Verify group exists and user is a member
-	groupCollection := config.GetCollection("groups")
-	var group models.Group
-	err = groupCollection.FindOne(ctx, bson.M{"_id": groupID}).Decode(&group)
+	group, err := store.Groups.FindByID(ctx, groupID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
 		return
 	}
 
-	isMember := false
-	for _, memberID := range group.Members {
-		if memberID == userID {
-			isMember = true
-			break
+	if !group.HasMember(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+		return
+	}
+	if !group.HasRole(userID, models.RoleMember) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Viewers cannot add expenses"})
+		return
+	}
+
+	currency := group.Currency()
+	if req.Currency != "" {
+		if currency, err = services.NormalizeCurrency(req.Currency); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 	}
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+
+	now := time.Now()
+	date := now
+	if req.Date != "" {
+		if date, err = services.ParseDate(req.Date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	category, err := groupCategory(group, req.Category)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payer, err := resolvePaidBy(group, userID, req.PaidBy, req.Payers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	paidBy, payers, err := buildPayers(group, req.Amount, payer, req.Payers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expenseID := primitive.NewObjectID()
+	splitType, splits, err := buildSplits(group, expenseID, req.Amount, req.SplitType, req.Participants)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Insert Expense
-	expenseCollection := config.GetCollection("expenses")
 	newExpense := models.Expense{
-		ID:          primitive.NewObjectID(),
+		ID:          expenseID,
 		GroupID:     groupID,
-		PaidBy:      userID,
+		PaidBy:      paidBy,
+		Payers:      payers,
 		Amount:      req.Amount,
+		Currency:    currency,
 		Description: req.Description,
-		CreatedAt:   time.Now(),
+		SplitType:   splitType,
+		Category:    category,
+		Tags:        tags,
+		CreatedBy:   userID,
+		Date:        date,
+		CreatedAt:   now,
 	}
 
-	_, err = expenseCollection.InsertOne(ctx, newExpense)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add expense"})
+	if !respondConvertToBase(c, ctx, group, &newExpense, splits) {
 		return
 	}
 
-	// Handle Splits (Equal Split for simplicity based on project details)
-	numMembers := float64(len(group.Members))
-	splitAmount := req.Amount / numMembers
-
-	splitCollection := config.GetCollection("splits")
-	var splits []interface{}
-
-	for _, memberID := range group.Members {
-		split := models.Split{
-			ID:        primitive.NewObjectID(),
-			ExpenseID: newExpense.ID,
-			UserID:    memberID,
-			Amount:    splitAmount,
+	// The expense is only stored together with its splits
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := store.Expenses.Create(ctx, &newExpense); err != nil {
+			return err
 		}
-		splits = append(splits, split)
-	}
-
-	_, err = splitCollection.InsertMany(ctx, splits)
+		if err := store.Splits.CreateMany(ctx, splits); err != nil {
+			return err
+		}
+		deltas := services.Balances{}
+		deltas.ApplyExpense(newExpense, splits)
+		return applyBalanceChanges(ctx, group.ID, deltas)
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate splits"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add expense"})
 		return
 	}
 
@@ -109,15 +156,135 @@ func AddExpense(c *gin.Context) {
 	})
 }
 
+// Page sizes of GetGroupExpenses
+const (
+	defaultExpensePageSize = 50
+	maxExpensePageSize     = 200
+)
+
+// GetGroupExpenses returns one page of a group's expenses, newest first by
+// default. Pass the returned nextCursor as ?cursor= to get the next page.
 func GetGroupExpenses(c *gin.Context) {
-	groupIDStr := c.Param("groupId")
-	groupID, err := primitive.ObjectIDFromHex(groupIDStr)
+	group := groupFromContext(c)
+
+	query, err := parseExpenseQuery(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	query.GroupID = group.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Fetch one extra expense to know whether there is a next page
+	limit := query.Limit
+	query.Limit++
+	expenses, err := repository.Get().Expenses.Search(ctx, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expenses"})
+		return
+	}
+
+	var nextCursor *string
+	if len(expenses) > limit {
+		expenses = expenses[:limit]
+		cursor := models.NewExpenseCursor(&expenses[limit-1], query.SortBy).Encode()
+		nextCursor = &cursor
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"expenses":   expenses,
+		"nextCursor": nextCursor,
+	})
+}
+
+// parseExpenseQuery reads the filters, sort order and page of GetGroupExpenses
+// from the query string
+func parseExpenseQuery(c *gin.Context) (models.ExpenseQuery, error) {
+	query := models.ExpenseQuery{
+		SortBy:   c.DefaultQuery("sort", models.ExpenseSortDate),
+		Category: normalizeCategory(c.Query("category")),
+		Tag:      normalizeCategory(c.Query("tag")),
+		Text:     strings.TrimSpace(c.Query("q")),
+		Limit:    defaultExpensePageSize,
+	}
+
+	switch query.SortBy {
+	case models.ExpenseSortDate, models.ExpenseSortAmount, models.ExpenseSortCreatedAt:
+	default:
+		return query, errors.New("sort must be date, amount or createdAt")
+	}
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		query.Ascending = true
+	case "desc":
+	default:
+		return query, errors.New("order must be asc or desc")
+	}
 
-	// Verify user is member of group
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxExpensePageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxExpensePageSize)
+		}
+		query.Limit = limit
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := models.DecodeExpenseCursor(value)
+		if err != nil {
+			return query, err
+		}
+		if cursor.SortBy != query.SortBy {
+			return query, errors.New("cursor belongs to a different sort order")
+		}
+		query.After = cursor
+	}
+
+	if value := c.Query("paidBy"); value != "" {
+		paidBy, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return query, errors.New("invalid paidBy user ID")
+		}
+		query.PaidBy = &paidBy
+	}
+
+	if value := c.Query("from"); value != "" {
+		from, err := services.ParseDate(value)
+		if err != nil {
+			return query, err
+		}
+		query.DateFrom = &from
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := services.ParseDate(value)
+		if err != nil {
+			return query, err
+		}
+		// A plain day includes the whole day
+		if len(strings.TrimSpace(value)) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1)
+		} else {
+			to = to.Add(time.Millisecond)
+		}
+		query.DateBefore = &to
+	}
+
+	for param, target := range map[string]**models.Money{"minAmount": &query.MinAmount, "maxAmount": &query.MaxAmount} {
+		if value := c.Query(param); value != "" {
+			amount, err := models.ParseMoney(value)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s: %v", param, err)
+			}
+			*target = &amount
+		}
+	}
+
+	return query, nil
+}
+
+func UpdateExpense(c *gin.Context) {
 	userIDStr, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
@@ -125,48 +292,473 @@ func GetGroupExpenses(c *gin.Context) {
 	}
 	userID, _ := primitive.ObjectIDFromHex(userIDStr.(string))
 
+	expenseID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
+		return
+	}
+
+	var req models.UpdateExpenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	groupCollection := config.GetCollection("groups")
-	var group models.Group
-	err = groupCollection.FindOne(ctx, bson.M{"_id": groupID}).Decode(&group)
+	store := repository.Get()
+	expense, group, ok := loadEditableExpense(c, ctx, expenseID, userID)
+	if !ok {
+		return
+	}
+
+	splitType, newSplits, err := buildSplits(group, expense.ID, req.Amount, req.SplitType, req.Participants)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	isMember := false
-	for _, memberID := range group.Members {
-		if memberID == userID {
-			isMember = true
-			break
+	payer, err := resolvePaidBy(group, expense.PaidBy, req.PaidBy, req.Payers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Without new payers the existing ones are kept, as long as they still cover the amount
+	payerInputs := req.Payers
+	if len(payerInputs) == 0 && req.PaidBy == "" && len(expense.Payers) > 0 {
+		for _, payer := range expense.Payers {
+			payerInputs = append(payerInputs, models.PayerInput{UserID: payer.UserID.Hex(), Amount: payer.Amount})
 		}
 	}
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+	paidBy, payers, err := buildPayers(group, req.Amount, payer, payerInputs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	expenseCollection := config.GetCollection("expenses")
-	
-	// Find all expenses matching the GroupID
-	cursor, err := expenseCollection.Find(ctx, bson.M{"groupId": groupID})
+	updated := *expense
+	updated.PaidBy = paidBy
+	updated.Payers = payers
+	updated.Amount = req.Amount
+	updated.Description = req.Description
+	updated.SplitType = splitType
+	// A category removed from the catalogue can still be kept
+	if req.Category != nil && normalizeCategory(*req.Category) != expense.Category {
+		if updated.Category, err = groupCategory(group, *req.Category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Tags != nil {
+		if updated.Tags, err = normalizeTags(req.Tags); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	now := time.Now()
+	updated.UpdatedAt = &now
+
+	// Currency and date are kept unless given; older expenses move to the group currency
+	if updated.InBaseCurrency() {
+		updated.Currency = group.Currency()
+	}
+	if req.Currency != "" {
+		if updated.Currency, err = services.NormalizeCurrency(req.Currency); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	updated.Date = expense.ExpenseDate()
+	if req.Date != "" {
+		if updated.Date, err = services.ParseDate(req.Date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !respondConvertToBase(c, ctx, group, &updated, newSplits) {
+		return
+	}
+
+	// Snapshot, expense and splits change together or not at all
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		current, oldSplits, err := expenseInTransaction(ctx, expense.ID)
+		if err != nil {
+			return err
+		}
+		if err := saveExpenseRevision(ctx, *current, oldSplits, models.RevisionUpdated, userID); err != nil {
+			return err
+		}
+		if err := store.Expenses.Replace(ctx, &updated); err != nil {
+			return err
+		}
+		if err := store.Splits.DeleteByExpense(ctx, expense.ID); err != nil {
+			return err
+		}
+		if err := store.Splits.CreateMany(ctx, newSplits); err != nil {
+			return err
+		}
+		deltas := services.Balances{}
+		deltas.RemoveExpense(*current, oldSplits)
+		deltas.ApplyExpense(updated, newSplits)
+		return applyBalanceChanges(ctx, group.ID, deltas)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expenses"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update expense"})
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var expenses []models.Expense
-	if err = cursor.All(ctx, &expenses); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode expenses"})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Expense updated successfully",
+		"expense": updated,
+		"splits":  newSplits,
+	})
+}
+
+func DeleteExpense(c *gin.Context) {
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID, _ := primitive.ObjectIDFromHex(userIDStr.(string))
+
+	expenseID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	store := repository.Get()
+	expense, _, ok := loadEditableExpense(c, ctx, expenseID, userID)
+	if !ok {
+		return
+	}
+
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		current, oldSplits, err := expenseInTransaction(ctx, expense.ID)
+		if err != nil {
+			return err
+		}
+		if err := saveExpenseRevision(ctx, *current, oldSplits, models.RevisionDeleted, userID); err != nil {
+			return err
+		}
+		if err := store.Expenses.Delete(ctx, expense.ID); err != nil {
+			return err
+		}
+		if err := store.Splits.DeleteByExpense(ctx, expense.ID); err != nil {
+			return err
+		}
+		deltas := services.Balances{}
+		deltas.RemoveExpense(*current, oldSplits)
+		return applyBalanceChanges(ctx, expense.GroupID, deltas)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete expense"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Expense deleted successfully"})
+}
+
+func GetExpenseHistory(c *gin.Context) {
+	group := groupFromContext(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var expenseID *primitive.ObjectID
+	if expenseIDStr := c.Query("expenseId"); expenseIDStr != "" {
+		id, err := primitive.ObjectIDFromHex(expenseIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
+			return
+		}
+		expenseID = &id
+	}
+
+	revisions, err := repository.Get().Expenses.FindRevisions(ctx, group.ID, expenseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expense history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// loadEditableExpense fetches an expense and its group and checks that userID
+// may change it: only a payer, whoever logged it or a group admin can, and
+// never a viewer.
+// On failure the error response has already been written.
+func loadEditableExpense(c *gin.Context, ctx context.Context, expenseID, userID primitive.ObjectID) (*models.Expense, *models.Group, bool) {
+	store := repository.Get()
+	expense, err := store.Expenses.FindByID(ctx, expenseID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+		return nil, nil, false
+	}
+
+	group, err := store.Groups.FindByID(ctx, expense.GroupID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return nil, nil, false
+	}
+
+	if !group.HasMember(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+		return nil, nil, false
+	}
+	if !group.HasRole(userID, models.RoleMember) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Viewers cannot change expenses"})
+		return nil, nil, false
+	}
+	if !expense.IsPayer(userID) && expense.CreatedBy != userID && !group.HasRole(userID, models.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the payer, the member who logged it or a group admin can change this expense"})
+		return nil, nil, false
+	}
+
+	return expense, group, true
+}
+
+// expenseInTransaction reads an expense and its splits again inside the
+// transaction changing it. The balance deltas must undo exactly the version
+// being replaced: a concurrent edit committed since the handler first read the
+// expense is then either seen here or aborts this transaction with a conflict.
+func expenseInTransaction(ctx context.Context, expenseID primitive.ObjectID) (*models.Expense, []models.Split, error) {
+	store := repository.Get()
+	expense, err := store.Expenses.FindByID(ctx, expenseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	splits, err := store.Splits.FindByExpense(ctx, expenseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return expense, splits, nil
+}
+
+// saveExpenseRevision stores the version of an expense as it was before a change
+func saveExpenseRevision(ctx context.Context, expense models.Expense, splits []models.Split, action string, changedBy primitive.ObjectID) error {
+	revision := models.ExpenseRevision{
+		ID:        primitive.NewObjectID(),
+		ExpenseID: expense.ID,
+		GroupID:   expense.GroupID,
+		Action:    action,
+		Expense:   expense,
+		Splits:    splits,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now(),
+	}
+	return repository.Get().Expenses.SaveRevision(ctx, &revision)
+}
+
+// respondConvertToBase converts an expense into the group currency, writing the
+// error response when no exchange rate is available
+func respondConvertToBase(c *gin.Context, ctx context.Context, group *models.Group, expense *models.Expense, splits []models.Split) bool {
+	err := convertToBase(ctx, group, expense, splits)
+	if errors.Is(err, errNoExchangeRate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert expense currency"})
+		return false
+	}
+	return true
+}
+
+// resolvePaidBy returns the member who paid the whole expense: the requested
+// paidBy if given, otherwise fallback. paidBy cannot be combined with payers.
+func resolvePaidBy(group *models.Group, fallback primitive.ObjectID, paidBy string, payers []models.PayerInput) (primitive.ObjectID, error) {
+	if paidBy == "" {
+		return fallback, nil
+	}
+	if len(payers) > 0 {
+		return primitive.NilObjectID, errors.New("use either paidBy or payers, not both")
+	}
+
+	payerID, err := primitive.ObjectIDFromHex(paidBy)
+	if err != nil {
+		return primitive.NilObjectID, errors.New("invalid paidBy user ID")
+	}
+	if !group.CanShareExpenses(payerID) {
+		return primitive.NilObjectID, errors.New("paidBy user " + paidBy + " is not a member or guest of this group")
+	}
+	return payerID, nil
+}
+
+// buildPayers validates who paid an expense. Without payer inputs defaultPayer
+// paid everything. Otherwise the contributions must come from members or guests and
+// add up to the amount; the largest contributor becomes the main payer.
+func buildPayers(group *models.Group, amount models.Money, defaultPayer primitive.ObjectID, inputs []models.PayerInput) (primitive.ObjectID, []models.PayerContribution, error) {
+	if len(inputs) == 0 {
+		return defaultPayer, nil, nil
+	}
+
+	var mainPayer primitive.ObjectID
+	var largest, sum models.Money
+	seen := make(map[primitive.ObjectID]bool)
+	payers := make([]models.PayerContribution, 0, len(inputs))
+	for _, input := range inputs {
+		payerID, err := primitive.ObjectIDFromHex(input.UserID)
+		if err != nil {
+			return primitive.NilObjectID, nil, errors.New("invalid payer ID")
+		}
+		if !group.CanShareExpenses(payerID) {
+			return primitive.NilObjectID, nil, errors.New("payer " + input.UserID + " is not a member or guest of this group")
+		}
+		if seen[payerID] {
+			return primitive.NilObjectID, nil, errors.New("payer " + input.UserID + " is listed more than once")
+		}
+		seen[payerID] = true
+
+		if input.Amount > largest {
+			largest = input.Amount
+			mainPayer = payerID
+		}
+		sum += input.Amount
+		payers = append(payers, models.PayerContribution{UserID: payerID, Amount: input.Amount})
+	}
+
+	if sum != amount {
+		return primitive.NilObjectID, nil, fmt.Errorf("payer contributions add up to %s but the expense total is %s", sum, amount)
+	}
+	return mainPayer, payers, nil
+}
+
+// buildSplits validates the split settings of an expense against the group and
+// returns the resolved split type with one split document per participant.
+// Without an explicit participant list the expense is shared by every member
+// and guest.
+func buildSplits(group *models.Group, expenseID primitive.ObjectID, amount models.Money, splitType string, reqParticipants []models.SplitParticipant) (string, []models.Split, error) {
+	if splitType == "" {
+		splitType = services.SplitEqual
+	}
+	if !services.IsValidSplitType(splitType) {
+		return "", nil, errors.New("invalid split type")
+	}
+
+	var participants []services.SplitInput
+	if len(reqParticipants) == 0 {
+		if splitType != services.SplitEqual {
+			return "", nil, errors.New("participants are required for " + splitType + " splits")
+		}
+		for _, memberID := range group.SharingIDs() {
+			participants = append(participants, services.SplitInput{UserID: memberID.Hex()})
+		}
+	} else {
+		for _, p := range reqParticipants {
+			participantID, err := primitive.ObjectIDFromHex(p.UserID)
+			if err != nil {
+				return "", nil, errors.New("invalid participant ID")
+			}
+			if !group.CanShareExpenses(participantID) {
+				return "", nil, errors.New("participant " + p.UserID + " is not a member or guest of this group")
+			}
+			participants = append(participants, services.SplitInput{
+				UserID:     p.UserID,
+				Amount:     p.Amount,
+				Percentage: p.Percentage,
+				Shares:     p.Shares,
+			})
+		}
+	}
+
+	results, err := services.CalculateSplits(splitType, amount, participants)
+	if err != nil {
+		return "", nil, err
+	}
+
+	splits := make([]models.Split, 0, len(results))
+	for _, result := range results {
+		participantID, _ := primitive.ObjectIDFromHex(result.UserID)
+		splits = append(splits, models.Split{
+			ID:        primitive.NewObjectID(),
+			ExpenseID: expenseID,
+			UserID:    participantID,
+			Amount:    result.Amount,
+		})
+	}
+	return splitType, splits, nil
+}
+
+// normalizeCategory trims and lower-cases a category so filters match regardless of case
+func normalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// groupCategory normalizes a category and checks it is in the group's
+// catalogue. An empty category is allowed.
+func groupCategory(group *models.Group, category string) (string, error) {
+	category = normalizeCategory(category)
+	if category != "" && !group.HasCategory(category) {
+		return "", fmt.Errorf("unknown category %q; add it to the group's categories first", category)
+	}
+	return category, nil
+}
+
+// normalizeTags trims and lower-cases tags like categories, dropping empty
+// and duplicate ones
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	for _, tag := range tags {
+		tag = normalizeCategory(tag)
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		if len(tag) > models.MaxTagLength {
+			return nil, fmt.Errorf("tags can be at most %d characters long", models.MaxTagLength)
+		}
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > models.MaxExpenseTags {
+		return nil, fmt.Errorf("an expense can have at most %d tags", models.MaxExpenseTags)
+	}
+	return normalized, nil
+}
+
+// GetExpenseTotals sums a group's expenses per category or tag (?by=), in
+// the group's base currency. It takes the same filters as GetGroupExpenses.
+func GetExpenseTotals(c *gin.Context) {
+	group := groupFromContext(c)
+
+	groupBy := c.DefaultQuery("by", models.ExpenseGroupCategory)
+	if groupBy != models.ExpenseGroupCategory && groupBy != models.ExpenseGroupTag {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "by must be category or tag"})
+		return
+	}
+	query, err := parseExpenseQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	query.GroupID = group.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	if expenses == nil {
-		expenses = []models.Expense{}
+	totals, err := repository.Get().Expenses.Totals(ctx, query, groupBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate totals"})
+		return
 	}
 
-	c.JSON(http.StatusOK, expenses)
+	c.JSON(http.StatusOK, gin.H{
+		"by":       groupBy,
+		"currency": group.Currency(),
+		"totals":   totals,
+	})
 }
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"expensetracker/models"
+	"expensetracker/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// exportHeader are the CSV columns of an export. Each expense becomes one
+// "payer" row per contribution and one "split" row per share; each recorded
+// payment becomes a "settlement" row from user to to_user.
+var exportHeader = []string{
+	"record", "date", "id", "description", "category", "tags", "currency",
+	"expense_amount", "expense_base_amount", "user_id", "user_name",
+	"amount", "base_amount", "to_user_id", "to_user_name", "note",
+}
+
+// exportFileName keeps letters, digits and dashes of the group name
+var exportFileName = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// ExportGroup streams a group's expenses with their splits and its recorded
+// payments as CSV or JSON (?format=csv|json). It takes the same filters as
+// GetGroupExpenses; from and to also apply to the payments.
+func ExportGroup(c *gin.Context) {
+	group := groupFromContext(c)
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv or json"})
+		return
+	}
+	query, err := parseExpenseQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query.GroupID = group.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	store := repository.Get()
+	settlements, err := store.Settlements.FindByGroup(ctx, group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments"})
+		return
+	}
+	settlements = slices.DeleteFunc(settlements, func(s models.Settlement) bool {
+		return (query.DateFrom != nil && s.CreatedAt.Before(*query.DateFrom)) ||
+			(query.DateBefore != nil && !s.CreatedAt.Before(*query.DateBefore))
+	})
+	slices.Reverse(settlements) // Oldest first, like the expenses
+	for i := range settlements {
+		if settlements[i].Currency == "" {
+			settlements[i].Currency = group.Currency()
+		}
+	}
+
+	names := map[primitive.ObjectID]string{}
+	name := func(userID primitive.ObjectID) string { return participantName(ctx, group, userID, names) }
+
+	fileName := strings.Trim(exportFileName.ReplaceAllString(group.Name, "-"), "-")
+	if fileName == "" {
+		fileName = "group"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-export.%s"`, fileName, format))
+
+	// From here on the response is streamed; an error can only cut it short
+	if format == "csv" {
+		err = exportCSV(c, ctx, group, query, settlements, name)
+	} else {
+		err = exportJSON(c, ctx, group, query, settlements, name)
+	}
+	if err != nil {
+		log.Printf("Export of group %s failed: %v", group.ID.Hex(), err)
+	}
+}
+
+// expenseCurrency returns the currency of an expense; expenses logged before
+// currencies were tracked are in the group's base currency
+func expenseCurrency(group *models.Group, expense *models.Expense) string {
+	if expense.InBaseCurrency() {
+		return group.Currency()
+	}
+	return expense.Currency
+}
+
+// spreadsheetText keeps a spreadsheet from evaluating a text cell as a
+// formula by prefixing a quote when it starts like one
+func spreadsheetText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func exportCSV(c *gin.Context, ctx context.Context, group *models.Group, query models.ExpenseQuery, settlements []models.Settlement, name func(primitive.ObjectID) string) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(exportHeader); err != nil {
+		return err
+	}
+
+	err := repository.Get().Expenses.Each(ctx, query, func(expense models.Expense, splits []models.Split) error {
+		row := func(record string, userID primitive.ObjectID, amount, baseAmount models.Money) []string {
+			return []string{
+				record, expense.ExpenseDate().Format("2006-01-02"), expense.ID.Hex(), spreadsheetText(expense.Description),
+				spreadsheetText(expense.Category), spreadsheetText(strings.Join(expense.Tags, ";")), expenseCurrency(group, &expense),
+				expense.Amount.String(), expense.BaseTotal().String(), userID.Hex(), spreadsheetText(name(userID)),
+				amount.String(), baseAmount.String(), "", "", "",
+			}
+		}
+		for _, payer := range expense.BasePaid() {
+			if err := w.Write(row("payer", payer.UserID, payer.Amount, payer.BaseAmount)); err != nil {
+				return err
+			}
+		}
+		for _, split := range splits {
+			if err := w.Write(row("split", split.UserID, split.Amount, expense.BaseOwed(split))); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, settlement := range settlements {
+		err := w.Write([]string{
+			"settlement", settlement.CreatedAt.Format("2006-01-02"), settlement.ID.Hex(), "", "", "", settlement.Currency,
+			"", "", settlement.FromUser.Hex(), spreadsheetText(name(settlement.FromUser)),
+			settlement.Amount.String(), settlement.Amount.String(), settlement.ToUser.Hex(), spreadsheetText(name(settlement.ToUser)), spreadsheetText(settlement.Note),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// exportJSON writes {group, expenses, settlements}, encoding one expense at a
+// time so large groups are never held in memory
+func exportJSON(c *gin.Context, ctx context.Context, group *models.Group, query models.ExpenseQuery, settlements []models.Settlement, name func(primitive.ObjectID) string) error {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	groupJSON, err := json.Marshal(gin.H{"id": group.ID, "name": group.Name, "currency": group.Currency()})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, `{"group":%s,"expenses":[`, groupJSON); err != nil {
+		return err
+	}
+
+	first := true
+	err = repository.Get().Expenses.Each(ctx, query, func(expense models.Expense, splits []models.Split) error {
+		payers := []gin.H{}
+		for _, payer := range expense.BasePaid() {
+			payers = append(payers, gin.H{"userId": payer.UserID, "name": name(payer.UserID), "amount": payer.Amount, "baseAmount": payer.BaseAmount})
+		}
+		shares := []gin.H{}
+		for _, split := range splits {
+			shares = append(shares, gin.H{"userId": split.UserID, "name": name(split.UserID), "amount": split.Amount, "baseAmount": expense.BaseOwed(split)})
+		}
+		data, err := json.Marshal(gin.H{
+			"id":          expense.ID,
+			"date":        expense.ExpenseDate(),
+			"description": expense.Description,
+			"category":    expense.Category,
+			"tags":        append([]string{}, expense.Tags...),
+			"currency":    expenseCurrency(group, &expense),
+			"amount":      expense.Amount,
+			"baseAmount":  expense.BaseTotal(),
+			"payers":      payers,
+			"splits":      shares,
+		})
+		if err != nil {
+			return err
+		}
+		if !first {
+			data = append([]byte{','}, data...)
+		}
+		first = false
+		_, err = c.Writer.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	rows := []gin.H{}
+	for _, settlement := range settlements {
+		rows = append(rows, gin.H{
+			"id":           settlement.ID,
+			"date":         settlement.CreatedAt,
+			"fromUser":     settlement.FromUser,
+			"fromUserName": name(settlement.FromUser),
+			"toUser":       settlement.ToUser,
+			"toUserName":   name(settlement.ToUser),
+			"amount":       settlement.Amount,
+			"currency":     settlement.Currency,
+			"note":         settlement.Note,
+		})
+	}
+	settlementsJSON, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.Writer, `],"settlements":%s}`, settlementsJSON)
+	return err
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"expensetracker/models"
+	"expensetracker/repository"
+	"expensetracker/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func UploadFXRates(c *gin.Context) {
+	var req models.UploadFXRatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rates := make([]models.FXRate, 0, len(req.Rates))
+	for _, input := range req.Rates {
+		base, err := services.NormalizeCurrency(input.Base)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		quote, err := services.NormalizeCurrency(input.Quote)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		date, err := services.ParseDate(input.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rates = append(rates, models.FXRate{
+			Base:  base,
+			Quote: quote,
+			Rate:  input.Rate,
+			Date:  date.Truncate(24 * time.Hour),
+		})
+	}
+
+	saveFXRates(c, rates, "manual")
+}
+
+// ImportFXRates accepts a CSV file with date, base, quote and rate columns,
+// either as a multipart "file" field or as the raw request body
+func ImportFXRates(c *gin.Context) {
+	var body io.Reader = c.Request.Body
+	if c.ContentType() == "multipart/form-data" {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A CSV file is required in the \"file\" field"})
+			return
+		}
+		opened, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+			return
+		}
+		defer opened.Close()
+		body = opened
+	}
+
+	rates, err := services.ParseFXRatesCSV(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saveFXRates(c, rates, "csv")
+}
+
+func GetFXRates(c *gin.Context) {
+	var base, quote string
+	var err error
+	if c.Query("base") != "" {
+		if base, err = services.NormalizeCurrency(c.Query("base")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if c.Query("quote") != "" {
+		if quote, err = services.NormalizeCurrency(c.Query("quote")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rates, err := repository.Get().FXRates.List(ctx, base, quote)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
+
+func saveFXRates(c *gin.Context, rates []models.FXRate, source string) {
+	now := time.Now()
+	for i := range rates {
+		if rates[i].Base == rates[i].Quote {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Base and quote currency must differ"})
+			return
+		}
+		rates[i].Source = source
+		rates[i].CreatedAt = now
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := repository.Get().FXRates.Upsert(ctx, rates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exchange rates"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Exchange rates saved successfully",
+		"count":   len(rates),
+	})
+}
+
+// errNoExchangeRate is returned when no stored rate covers a conversion
+var errNoExchangeRate = errors.New("no exchange rate available")
+
+// exchangeRate returns how many units of to one unit of from was worth at the
+// given time, using the latest stored rate on or before it. Rates stored for
+// the opposite direction are inverted.
+func exchangeRate(ctx context.Context, from, to string, at time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	rates := repository.Get().FXRates
+	rate, err := rates.FindLatest(ctx, from, to, at)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return 0, err
+	}
+	inverse, inverseErr := rates.FindLatest(ctx, to, from, at)
+	if inverseErr != nil && !errors.Is(inverseErr, repository.ErrNotFound) {
+		return 0, inverseErr
+	}
+
+	// Prefer whichever direction was quoted closest to the requested date
+	switch {
+	case rate != nil && (inverse == nil || !inverse.Date.After(rate.Date)):
+		return rate.Rate, nil
+	case inverse != nil:
+		return 1 / inverse.Rate, nil
+	}
+	return 0, fmt.Errorf("%w from %s to %s on %s", errNoExchangeRate, from, to, at.Format("2006-01-02"))
+}
+
+// convertToBase fills in the group currency amounts of an expense and its splits
+func convertToBase(ctx context.Context, group *models.Group, expense *models.Expense, splits []models.Split) error {
+	rate, err := exchangeRate(ctx, expense.Currency, group.Currency(), expense.ExpenseDate())
+	if err != nil {
+		return err
+	}
+	return services.ConvertExpense(expense, splits, rate)
+}
@@ -2,14 +2,15 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
-	"expensetracker/config"
 	"expensetracker/models"
+	"expensetracker/repository"
+	"expensetracker/services"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -32,32 +33,48 @@ func CreateGroup(c *gin.Context) {
 		return
 	}
 
-	collection := config.GetCollection("groups")
+	baseCurrency := models.DefaultCurrency
+	if req.BaseCurrency != "" {
+		if baseCurrency, err = services.NormalizeCurrency(req.BaseCurrency); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	store := repository.Get()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	newGroup := models.Group{
-		ID:        primitive.NewObjectID(),
-		Name:      req.Name,
-		CreatedBy: userID,
-		Members:   []primitive.ObjectID{userID}, // Creator is automatically a member
-		CreatedAt: time.Now(),
+		ID:           primitive.NewObjectID(),
+		Name:         req.Name,
+		BaseCurrency: baseCurrency,
+		CreatedBy:    userID,
+		Members:      []primitive.ObjectID{userID}, // Creator is automatically a member
+		Roles:        map[string]string{userID.Hex(): models.RoleOwner},
+		CreatedAt:    time.Now(),
 	}
 
-	_, err = collection.InsertOne(ctx, newGroup)
+	// Create the group and add its ID to the User's groups array together
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := store.Groups.Create(ctx, &newGroup); err != nil {
+			return err
+		}
+		err := store.Balances.Replace(ctx, &models.GroupBalance{
+			GroupID:   newGroup.ID,
+			Balances:  map[string]models.Money{},
+			UpdatedAt: newGroup.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		return store.Users.AddGroup(ctx, userID, newGroup.ID)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
 		return
 	}
 
-	// Also add group ID to User's groups array
-	userCollection := config.GetCollection("users")
-	_, err = userCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": userID},
-		bson.M{"$push": bson.M{"groups": newGroup.ID}},
-	)
-
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Group created successfully",
 		"group":   newGroup,
@@ -65,12 +82,8 @@ func CreateGroup(c *gin.Context) {
 }
 
 func AddMember(c *gin.Context) {
-	groupIDStr := c.Param("id")
-	groupID, err := primitive.ObjectIDFromHex(groupIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
-		return
-	}
+	group := groupFromContext(c)
+	groupID := group.ID
 
 	var req models.AddMemberRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -78,78 +91,158 @@ func AddMember(c *gin.Context) {
 		return
 	}
 
+	store := repository.Get()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Find the user to add by email
-	userCollection := config.GetCollection("users")
-	var userToAdd models.User
-	err = userCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&userToAdd)
+	userToAdd, err := store.Users.FindByEmail(ctx, normalizeEmail(req.Email))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User with this email not found"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "User with this email not found; send them an invitation instead"})
 		return
 	}
 
-	// Add user to Group's members array
-	groupCollection := config.GetCollection("groups")
-	
-	// Check if already a member
-	var group models.Group
-	err = groupCollection.FindOne(ctx, bson.M{"_id": groupID}).Decode(&group)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+	if group.HasMember(userToAdd.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is already a member of this group"})
 		return
 	}
-	
-	for _, memberID := range group.Members {
-		if memberID == userToAdd.ID {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "User is already a member of this group"})
-			return
-		}
+
+	role, ok := newMemberRole(c, group, req.Role)
+	if !ok {
+		return
 	}
 
-	_, err = groupCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": groupID},
-		bson.M{"$push": bson.M{"members": userToAdd.ID}},
-	)
+	// Add user to Group's members array and group ID to User's groups array
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		return addGroupMember(ctx, groupID, userToAdd.ID, role)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member to group"})
 		return
 	}
 
-	// Add group ID to User's groups array
-	_, err = userCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": userToAdd.ID},
-		bson.M{"$push": bson.M{"groups": groupID}},
-	)
-
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User added to group successfully",
 	})
 }
 
 func GetGroupDetails(c *gin.Context) {
-	groupIDStr := c.Param("id")
-	groupID, err := primitive.ObjectIDFromHex(groupIDStr)
+	group := *groupFromContext(c)
+	group.Roles = group.MemberRoles()
+	c.JSON(http.StatusOK, group)
+}
+
+// UpdateGroup renames a group
+func UpdateGroup(c *gin.Context) {
+	group := groupFromContext(c)
+
+	var req models.UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := repository.Get().Groups.Rename(ctx, group.ID, req.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group updated successfully"})
+}
+
+// UpdateMemberRole promotes or demotes a member. Admins can move members
+// between the member and viewer roles; only the owner can grant or revoke
+// admin. The owner's own role only changes by transferring ownership.
+func UpdateMemberRole(c *gin.Context) {
+	group := groupFromContext(c)
+	callerID := currentUserID(c)
+
+	targetID, err := primitive.ObjectIDFromHex(c.Param("userId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currentRole := group.Role(targetID)
+	switch {
+	case currentRole == "":
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this group"})
+		return
+	case currentRole == models.RoleOwner:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The owner's role can only change by transferring ownership"})
+		return
+	case (currentRole == models.RoleAdmin || req.Role == models.RoleAdmin) && !group.HasRole(callerID, models.RoleOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the group owner can grant or revoke admin"})
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	groupCollection := config.GetCollection("groups")
-	var group models.Group
-	err = groupCollection.FindOne(ctx, bson.M{"_id": groupID}).Decode(&group)
+	err = repository.Get().Groups.SetRoles(ctx, group.ID, map[primitive.ObjectID]string{targetID: req.Role})
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
 		return
 	}
 
-	c.JSON(http.StatusOK, group)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role updated successfully",
+		"userId":  targetID.Hex(),
+		"role":    req.Role,
+	})
+}
+
+// TransferOwnership hands the owner role to another member. The previous
+// owner stays on as an admin.
+func TransferOwnership(c *gin.Context) {
+	group := groupFromContext(c)
+	callerID := currentUserID(c)
+
+	var req models.TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	newOwnerID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if !group.HasMember(newOwnerID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The new owner must be a member of this group"})
+		return
+	}
+	if newOwnerID == callerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already own this group"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = repository.Get().Groups.SetRoles(ctx, group.ID, map[primitive.ObjectID]string{
+		newOwnerID: models.RoleOwner,
+		callerID:   models.RoleAdmin,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Ownership transferred successfully",
+		"ownerId": newOwnerID.Hex(),
+	})
 }
 
 func GetUserGroups(c *gin.Context) {
@@ -168,26 +261,155 @@ func GetUserGroups(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	groupCollection := config.GetCollection("groups")
-	
 	// Find all groups where the user is in the Members array
-	cursor, err := groupCollection.Find(ctx, bson.M{"members": userID})
+	groups, err := repository.Get().Groups.FindByMember(ctx, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch groups"})
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var groups []models.Group
-	if err = cursor.All(ctx, &groups); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode groups"})
+	c.JSON(http.StatusOK, groups)
+}
+
+// groupFromContext returns the group loaded by middleware.GroupMember
+func groupFromContext(c *gin.Context) *models.Group {
+	return c.MustGet("group").(*models.Group)
+}
+
+// RemoveMember removes another member from the group (admin). Only the
+// owner can remove an admin, and the owner cannot be removed.
+func RemoveMember(c *gin.Context) {
+	group := groupFromContext(c)
+	callerID := currentUserID(c)
+
+	targetID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	// Always return an array, even if empty
-	if groups == nil {
-		groups = []models.Group{}
+	switch group.Role(targetID) {
+	case "":
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this group"})
+		return
+	case models.RoleOwner:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The owner cannot be removed from the group"})
+		return
+	case models.RoleAdmin:
+		if !group.HasRole(callerID, models.RoleOwner) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the group owner can remove admins"})
+			return
+		}
 	}
 
-	c.JSON(http.StatusOK, groups)
+	if removeMember(c, group, targetID) {
+		c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+	}
+}
+
+// LeaveGroup removes the caller from the group. The owner has to transfer
+// ownership first.
+func LeaveGroup(c *gin.Context) {
+	group := groupFromContext(c)
+	userID := currentUserID(c)
+
+	if group.Role(userID) == models.RoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Transfer ownership before leaving the group"})
+		return
+	}
+
+	if removeMember(c, group, userID) {
+		c.JSON(http.StatusOK, gin.H{"message": "You have left the group"})
+	}
+}
+
+// errOutstandingBalance stops removing a member who still owes or is owed money
+var errOutstandingBalance = errors.New("member has an outstanding balance")
+
+// removeMember takes userID out of the group unless they still owe or are
+// owed money; ?force=true overrides that check. The user becomes a former
+// member so their past expenses and payments keep counting, and settlement
+// rules naming them are dropped. On failure the error response has already
+// been written.
+func removeMember(c *gin.Context, group *models.Group, userID primitive.ObjectID) bool {
+	store := repository.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var balance models.Money
+	err := store.WithTransaction(ctx, func(ctx context.Context) error {
+		if c.Query("force") != "true" {
+			balances, err := lockedGroupBalances(ctx, group.ID)
+			if err != nil {
+				return err
+			}
+			if balance = balances[userID.Hex()]; balance != 0 {
+				return errOutstandingBalance
+			}
+		}
+
+		// Re-read the rules so a concurrent change to them is not overwritten
+		current, err := store.Groups.FindByID(ctx, group.ID)
+		if err != nil {
+			return err
+		}
+		if current.SettlementRules.Names(userID) {
+			if err := store.Groups.SetSettlementRules(ctx, group.ID, current.SettlementRules.WithoutUser(userID)); err != nil {
+				return err
+			}
+		}
+
+		if err := store.Groups.RemoveMember(ctx, group.ID, userID); err != nil {
+			return err
+		}
+		err = store.Users.RemoveGroup(ctx, userID, group.ID)
+		if errors.Is(err, repository.ErrNotFound) {
+			// The user account no longer exists; the group side is all that is left
+			return nil
+		}
+		return err
+	})
+	if errors.Is(err, errOutstandingBalance) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Member has an outstanding balance; settle up first or retry with ?force=true",
+			"balance":  balance,
+			"currency": group.Currency(),
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return false
+	}
+	return true
+}
+
+// newMemberRole returns the role a new member gets, defaulting to member.
+// Only the owner can bring in admins. On failure the error response has
+// already been written.
+func newMemberRole(c *gin.Context, group *models.Group, requested string) (string, bool) {
+	if requested == "" {
+		return models.RoleMember, true
+	}
+	if requested == models.RoleAdmin && !group.HasRole(currentUserID(c), models.RoleOwner) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the group owner can add admins"})
+		return "", false
+	}
+	return requested, true
+}
+
+// addGroupMember adds userID to the group's members and the group to the
+// user's groups. Run it inside a transaction.
+func addGroupMember(ctx context.Context, groupID, userID primitive.ObjectID, role string) error {
+	store := repository.Get()
+	if err := store.Groups.AddMember(ctx, groupID, userID, role); err != nil {
+		return err
+	}
+	return store.Users.AddGroup(ctx, userID, groupID)
+}
+
+// currentUserID returns the authenticated user's ID set by AuthMiddleware
+func currentUserID(c *gin.Context) primitive.ObjectID {
+	userID, _ := primitive.ObjectIDFromHex(c.GetString("userID"))
+	return userID
 }
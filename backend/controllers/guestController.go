@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"expensetracker/models"
+	"expensetracker/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AddGuest adds a placeholder member who has no account. The guest's ID can
+// be used as payer or participant of expenses and in payments.
+func AddGuest(c *gin.Context) {
+	group := groupFromContext(c)
+
+	var req models.AddGuestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	guest := models.GuestMember{
+		ID:        primitive.NewObjectID(),
+		Name:      req.Name,
+		AddedBy:   currentUserID(c),
+		CreatedAt: time.Now(),
+	}
+
+	if err := repository.Get().Groups.AddGuest(ctx, group.ID, guest); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add guest"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Guest added successfully",
+		"guest":   guest,
+	})
+}
+
+// MergeGuest hands a guest's expenses, splits and payments over to a
+// registered member, typically once the person behind the guest signed up,
+// and removes the guest from the group
+func MergeGuest(c *gin.Context) {
+	group := groupFromContext(c)
+
+	guestID, err := primitive.ObjectIDFromHex(c.Param("guestId"))
+	if err != nil || group.Guest(guestID) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found"})
+		return
+	}
+
+	var req models.MergeGuestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if !group.HasMember(userID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A guest can only be merged into a member of this group"})
+		return
+	}
+
+	store := repository.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		expenses, err := store.Expenses.FindByGroup(ctx, group.ID)
+		if err != nil {
+			return err
+		}
+		expenseIDs := make([]primitive.ObjectID, len(expenses))
+		for i, expense := range expenses {
+			expenseIDs[i] = expense.ID
+		}
+
+		if err := store.Expenses.ReassignUser(ctx, group.ID, guestID, userID); err != nil {
+			return err
+		}
+		if err := store.Splits.ReassignUser(ctx, expenseIDs, guestID, userID); err != nil {
+			return err
+		}
+		if err := store.Settlements.ReassignUser(ctx, group.ID, guestID, userID); err != nil {
+			return err
+		}
+		// Re-read the rules so a concurrent change to them is not overwritten
+		current, err := store.Groups.FindByID(ctx, group.ID)
+		if err != nil {
+			return err
+		}
+		if current.SettlementRules.Names(guestID) {
+			if err := store.Groups.SetSettlementRules(ctx, group.ID, current.SettlementRules.ReassignUser(guestID, userID)); err != nil {
+				return err
+			}
+		}
+		if err := store.Groups.RemoveGuest(ctx, group.ID, guestID); err != nil {
+			return err
+		}
+		_, err = rebuildGroupBalances(ctx, group.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge guest"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Guest merged successfully"})
+}
@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"expensetracker/models"
+	"expensetracker/repository"
+	"expensetracker/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxImportSize bounds the size of an uploaded expense import
+const maxImportSize = 5 << 20
+
+// ImportExpenses imports expenses from a CSV file, sent as the "file" form
+// field or as the raw body. Every row is validated first. With ?dryRun=true
+// only the validation report is returned; otherwise all rows are stored in
+// one transaction, or none if any row is invalid.
+func ImportExpenses(c *gin.Context) {
+	group := groupFromContext(c)
+	userID := currentUserID(c)
+	dryRun := c.Query("dryRun") == "true"
+
+	// Bound the body before anything reads it: FormFile parses all of it
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	var body io.Reader = c.Request.Body
+	if c.ContentType() == "multipart/form-data" {
+		file, err := c.FormFile("file")
+		if isBodyTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "CSV file is too large"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A CSV file is required in the \"file\" field"})
+			return
+		}
+		opened, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+			return
+		}
+		defer opened.Close()
+		body = opened
+	}
+
+	rows, err := services.ParseExpenseImportCSV(body)
+	if isBodyTooLarge(err) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "CSV file is too large"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// Validate every row the same way AddExpense would
+	resolve := importResolver(ctx, group)
+	type importedExpense struct {
+		expense models.Expense
+		splits  []models.Split
+	}
+	var imported []importedExpense
+	rowErrors := []gin.H{}
+	preview := []gin.H{}
+	now := time.Now()
+	for _, row := range rows {
+		expense, splits, err := buildImportedExpense(ctx, group, userID, row, resolve, now)
+		var rowErr importRowError
+		if errors.As(err, &rowErr) {
+			rowErrors = append(rowErrors, gin.H{"line": row.Line, "error": rowErr.Error()})
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate import"})
+			return
+		}
+		imported = append(imported, importedExpense{*expense, splits})
+		preview = append(preview, gin.H{
+			"line":         row.Line,
+			"date":         expense.Date.Format("2006-01-02"),
+			"description":  expense.Description,
+			"amount":       expense.Amount,
+			"currency":     expense.Currency,
+			"baseAmount":   expense.BaseAmount,
+			"paidBy":       expense.PaidBy,
+			"participants": len(splits),
+		})
+	}
+
+	report := gin.H{
+		"dryRun":   dryRun,
+		"valid":    len(rowErrors) == 0,
+		"rows":     len(rows),
+		"errors":   rowErrors,
+		"expenses": preview,
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	if len(rowErrors) > 0 {
+		report["error"] = "Import has invalid rows; nothing was imported"
+		c.JSON(http.StatusUnprocessableEntity, report)
+		return
+	}
+
+	// All or nothing: the expenses, their splits and the balances together,
+	// each written in one batch to keep the transaction short
+	expenses := make([]models.Expense, 0, len(imported))
+	var splits []models.Split
+	deltas := services.Balances{}
+	for _, item := range imported {
+		expenses = append(expenses, item.expense)
+		splits = append(splits, item.splits...)
+		deltas.ApplyExpense(item.expense, item.splits)
+	}
+	store := repository.Get()
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := store.Expenses.CreateMany(ctx, expenses); err != nil {
+			return err
+		}
+		if err := store.Splits.CreateMany(ctx, splits); err != nil {
+			return err
+		}
+		return applyBalanceChanges(ctx, group.ID, deltas)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import expenses"})
+		return
+	}
+
+	report["message"] = fmt.Sprintf("Imported %d expenses", len(imported))
+	report["imported"] = len(imported)
+	c.JSON(http.StatusCreated, report)
+}
+
+// isBodyTooLarge reports whether reading the request body hit maxImportSize
+func isBodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// importRowError is a problem with one import row, reported back to the
+// caller rather than failing the request
+type importRowError struct{ error }
+
+// importResolver returns a function finding the member or guest an import
+// row names: registered users by email, guests by name
+func importResolver(ctx context.Context, group *models.Group) func(name string) (primitive.ObjectID, error) {
+	cache := map[string]primitive.ObjectID{}
+	return func(name string) (primitive.ObjectID, error) {
+		isEmail := strings.Contains(name, "@")
+		if isEmail {
+			// Emails are stored lower-cased; cache them in that form too
+			name = normalizeEmail(name)
+		}
+		if id, ok := cache[name]; ok {
+			return id, nil
+		}
+		if isEmail {
+			user, err := repository.Get().Users.FindByEmail(ctx, name)
+			if errors.Is(err, repository.ErrNotFound) || (err == nil && !group.CanShareExpenses(user.ID)) {
+				return primitive.NilObjectID, importRowError{fmt.Errorf("%s is not a member of this group", name)}
+			}
+			if err != nil {
+				return primitive.NilObjectID, err
+			}
+			cache[name] = user.ID
+			return user.ID, nil
+		}
+		for _, guest := range group.Guests {
+			if strings.EqualFold(guest.Name, name) {
+				cache[name] = guest.ID
+				return guest.ID, nil
+			}
+		}
+		return primitive.NilObjectID, importRowError{fmt.Errorf("%s is neither a member's email nor a guest of this group", name)}
+	}
+}
+
+// buildImportedExpense turns an import row into an expense and its splits,
+// converted into the group's base currency. Problems with the row itself are
+// returned as importRowError.
+func buildImportedExpense(ctx context.Context, group *models.Group, userID primitive.ObjectID, row services.ExpenseImportRow, resolve func(string) (primitive.ObjectID, error), now time.Time) (*models.Expense, []models.Split, error) {
+	if row.Err != nil {
+		return nil, nil, importRowError{row.Err}
+	}
+	date, err := services.ParseDate(row.Date)
+	if err != nil {
+		return nil, nil, importRowError{err}
+	}
+	currency := group.Currency()
+	if row.Currency != "" {
+		if currency, err = services.NormalizeCurrency(row.Currency); err != nil {
+			return nil, nil, importRowError{err}
+		}
+	}
+	category, err := groupCategory(group, row.Category)
+	if err != nil {
+		return nil, nil, importRowError{err}
+	}
+	tags, err := normalizeTags(row.Tags)
+	if err != nil {
+		return nil, nil, importRowError{err}
+	}
+
+	// A single payer without an amount paid everything
+	payerID, err := resolve(row.Payers[0].Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var payerInputs []models.PayerInput
+	if len(row.Payers) > 1 || row.Payers[0].Value != "" {
+		for _, payer := range row.Payers {
+			id, err := resolve(payer.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			amount, err := models.ParseMoney(payer.Value)
+			if err != nil {
+				return nil, nil, importRowError{fmt.Errorf("invalid amount for payer %s", payer.Name)}
+			}
+			payerInputs = append(payerInputs, models.PayerInput{UserID: id.Hex(), Amount: amount})
+		}
+	}
+	paidBy, payers, err := buildPayers(group, row.Amount, payerID, payerInputs)
+	if err != nil {
+		return nil, nil, importRowError{err}
+	}
+
+	var participants []models.SplitParticipant
+	for _, person := range row.Participants {
+		id, err := resolve(person.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		participant := models.SplitParticipant{UserID: id.Hex()}
+		switch row.SplitType {
+		case services.SplitExact:
+			if participant.Amount, err = models.ParseMoney(person.Value); err != nil {
+				return nil, nil, importRowError{fmt.Errorf("invalid amount for %s", person.Name)}
+			}
+		case services.SplitPercentage, services.SplitShares:
+			value, err := strconv.ParseFloat(strings.TrimSuffix(person.Value, "%"), 64)
+			if err != nil {
+				return nil, nil, importRowError{fmt.Errorf("invalid %s for %s", row.SplitType, person.Name)}
+			}
+			if row.SplitType == services.SplitPercentage {
+				participant.Percentage = value
+			} else {
+				participant.Shares = value
+			}
+		}
+		participants = append(participants, participant)
+	}
+
+	expenseID := primitive.NewObjectID()
+	splitType, splits, err := buildSplits(group, expenseID, row.Amount, row.SplitType, participants)
+	if err != nil {
+		return nil, nil, importRowError{err}
+	}
+
+	expense := models.Expense{
+		ID:          expenseID,
+		GroupID:     group.ID,
+		PaidBy:      paidBy,
+		Payers:      payers,
+		Amount:      row.Amount,
+		Currency:    currency,
+		Description: row.Description,
+		SplitType:   splitType,
+		Category:    category,
+		Tags:        tags,
+		CreatedBy:   userID,
+		Date:        date,
+		CreatedAt:   now,
+	}
+	err = convertToBase(ctx, group, &expense, splits)
+	if errors.Is(err, errNoExchangeRate) {
+		return nil, nil, importRowError{err}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &expense, splits, nil
+}
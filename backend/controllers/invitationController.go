@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"expensetracker/models"
+	"expensetracker/repository"
+	"expensetracker/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateInvitation invites an email address to the group (admin). The
+// returned token can be shared as a link; the invitee accepts it once logged
+// in, or joins automatically when signing up with the invited email.
+func CreateInvitation(c *gin.Context) {
+	group := groupFromContext(c)
+
+	var req models.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, ok := newMemberRole(c, group, req.Role)
+	if !ok {
+		return
+	}
+
+	store := repository.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	email := normalizeEmail(req.Email)
+	if user, err := store.Users.FindByEmail(ctx, email); err == nil && group.HasMember(user.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User is already a member of this group"})
+		return
+	}
+
+	now := time.Now()
+	invitation := models.Invitation{
+		ID:        primitive.NewObjectID(),
+		GroupID:   group.ID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: currentUserID(c),
+		ExpiresAt: now.Add(utils.InviteTokenTTL),
+		CreatedAt: now,
+	}
+
+	token, err := utils.GenerateInviteToken(invitation.ID.Hex(), invitation.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation"})
+		return
+	}
+
+	if err := store.Invitations.Create(ctx, &invitation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Invitation created successfully",
+		"invitation": invitation,
+		"token":      token,
+	})
+}
+
+// AcceptInvitation adds the logged-in user to the group of an invitation
+// addressed to their email
+func AcceptInvitation(c *gin.Context) {
+	invitationIDStr, err := utils.ParseInviteToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+	invitationID, err := primitive.ObjectIDFromHex(invitationIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation"})
+		return
+	}
+
+	store := repository.Get()
+	userID := currentUserID(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	invitation, err := store.Invitations.FindByID(ctx, invitationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+	if invitation.AcceptedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation has already been accepted"})
+		return
+	}
+
+	user, err := store.Users.FindByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if strings.ToLower(user.Email) != invitation.Email {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This invitation was sent to a different email address"})
+		return
+	}
+
+	group, err := store.Groups.FindByID(ctx, invitation.GroupID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		return acceptInvitation(ctx, group, invitation, userID)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation has already been accepted"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitation accepted",
+		"groupId": group.ID.Hex(),
+	})
+}
+
+// acceptInvitation marks an invitation accepted by userID and adds them to
+// the group unless they already are a member. Run it inside a transaction.
+func acceptInvitation(ctx context.Context, group *models.Group, invitation *models.Invitation, userID primitive.ObjectID) error {
+	if err := repository.Get().Invitations.MarkAccepted(ctx, invitation.ID, userID, time.Now()); err != nil {
+		return err
+	}
+	if group.HasMember(userID) {
+		return nil
+	}
+	return addGroupMember(ctx, group.ID, userID, invitation.Role)
+}
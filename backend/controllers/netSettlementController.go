@@ -0,0 +1,323 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"expensetracker/config"
+	"expensetracker/models"
+	"expensetracker/repository"
+	"expensetracker/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// groupDebt is what a user owes one person in one group under the group's
+// settlement plan. Amount is negative when that person owes the user.
+type groupDebt struct {
+	Group        *models.Group
+	Counterparty primitive.ObjectID
+	Amount       models.Money
+}
+
+// userGroupDebts collects, over every group of userID, the transfers the
+// group's settlement plan asks them to make or to receive. Groups whose
+// rules allow no plan are returned separately. balancesOf reads a group's
+// balances: groupBalances, or lockedGroupBalances inside a transaction.
+func userGroupDebts(ctx context.Context, userID primitive.ObjectID, balancesOf func(context.Context, primitive.ObjectID) (services.Balances, error)) (debts []groupDebt, skipped []models.Group, err error) {
+	groups, err := repository.Get().Groups.FindByMember(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range groups {
+		group := &groups[i]
+		balances, err := balancesOf(ctx, group.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if balances[userID.Hex()] == 0 {
+			continue
+		}
+
+		transactions, _, err := services.SettleBalances(balances, services.AlgorithmExact, config.ExactSettlementMaxSize(), settlementConstraints(group))
+		if errors.Is(err, services.ErrNoValidSettlement) {
+			skipped = append(skipped, *group)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		perCounterparty := map[string]models.Money{}
+		for _, transaction := range transactions {
+			switch userID.Hex() {
+			case transaction.FromUser:
+				perCounterparty[transaction.ToUser] += transaction.Amount
+			case transaction.ToUser:
+				perCounterparty[transaction.FromUser] -= transaction.Amount
+			}
+		}
+		for hex, amount := range perCounterparty {
+			counterparty, _ := primitive.ObjectIDFromHex(hex)
+			if amount != 0 {
+				debts = append(debts, groupDebt{Group: group, Counterparty: counterparty, Amount: amount})
+			}
+		}
+	}
+
+	// Stable output: by counterparty, then by group
+	slices.SortFunc(debts, func(a, b groupDebt) int {
+		if c := strings.Compare(a.Counterparty.Hex(), b.Counterparty.Hex()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Group.ID.Hex(), b.Group.ID.Hex())
+	})
+	return debts, skipped, nil
+}
+
+// participantName resolves a registered user's name, or a guest's name from
+// the group they belong to
+func participantName(ctx context.Context, group *models.Group, userID primitive.ObjectID, cache map[primitive.ObjectID]string) string {
+	if name, ok := cache[userID]; ok {
+		return name
+	}
+	name := ""
+	if guest := group.Guest(userID); guest != nil {
+		name = guest.Name
+	} else if user, err := repository.Get().Users.FindByID(ctx, userID); err == nil {
+		name = user.Name
+	}
+	cache[userID] = name
+	return name
+}
+
+// GetMyBalances nets what the current user owes and is owed across all of
+// their groups, per counterparty and currency
+func GetMyBalances(c *gin.Context) {
+	userID := currentUserID(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	debts, skipped, err := userGroupDebts(ctx, userID, groupBalances)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate balances"})
+		return
+	}
+
+	type counterpartyKey struct {
+		userID   primitive.ObjectID
+		currency string
+	}
+	var order []counterpartyKey
+	entries := map[counterpartyKey]gin.H{}
+	names := map[primitive.ObjectID]string{}
+	for _, debt := range debts {
+		key := counterpartyKey{debt.Counterparty, debt.Group.Currency()}
+		entry, ok := entries[key]
+		if !ok {
+			entry = gin.H{
+				"userId":   debt.Counterparty,
+				"name":     participantName(ctx, debt.Group, debt.Counterparty, names),
+				"currency": key.currency,
+				"net":      models.Money(0),
+				"groups":   []gin.H{},
+			}
+			entries[key] = entry
+			order = append(order, key)
+		}
+		entry["net"] = entry["net"].(models.Money) + debt.Amount
+		entry["groups"] = append(entry["groups"].([]gin.H), gin.H{
+			"groupId":   debt.Group.ID,
+			"groupName": debt.Group.Name,
+			"amount":    debt.Amount,
+		})
+	}
+
+	counterparties := []gin.H{}
+	for _, key := range order {
+		counterparties = append(counterparties, entries[key])
+	}
+	skippedGroups := []primitive.ObjectID{}
+	for _, group := range skipped {
+		skippedGroups = append(skippedGroups, group.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"counterparties": counterparties,
+		"skippedGroups":  skippedGroups,
+	})
+}
+
+// PayAcrossGroups records one payment from the current user to another
+// person and allocates it over the groups they share. What the other person
+// owes the user is offset first: it is recorded as paid in its group, and
+// the payment plus those offsets pays off the user's debts, largest first.
+func PayAcrossGroups(c *gin.Context) {
+	userID := currentUserID(c)
+
+	var req models.CrossGroupPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	toUser, err := primitive.ObjectIDFromHex(req.ToUser)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipient ID"})
+		return
+	}
+	if toUser == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payer and recipient must be different people"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	allocationID := primitive.NewObjectID()
+	var settlements []models.Settlement
+	var amount models.Money
+	store := repository.Get()
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		// The debts are read inside the transaction, so a concurrent change
+		// to any of the groups aborts it instead of allocating stale amounts
+		debts, _, err := userGroupDebts(ctx, userID, lockedGroupBalances)
+		if err != nil {
+			return err
+		}
+		settlements, amount, err = allocateCrossGroupPayment(debts, userID, toUser, req, allocationID)
+		if err != nil {
+			return err
+		}
+
+		for _, settlement := range settlements {
+			if err := store.Settlements.Create(ctx, &settlement); err != nil {
+				return err
+			}
+			deltas := services.Balances{}
+			deltas.ApplySettlement(settlement)
+			if err := applyBalanceChanges(ctx, settlement.GroupID, deltas); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var rejected *paymentRejection
+	if errors.As(err, &rejected) {
+		c.JSON(http.StatusBadRequest, rejected.body)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Payment recorded successfully",
+		"allocationId": allocationID,
+		"amount":       amount,
+		"currency":     settlements[0].Currency,
+		"settlements":  settlements,
+	})
+}
+
+// paymentRejection is why a cross-group payment cannot be made as requested;
+// body is sent back with a 400
+type paymentRejection struct {
+	body gin.H
+}
+
+func (r *paymentRejection) Error() string {
+	return fmt.Sprint(r.body["error"])
+}
+
+// allocateCrossGroupPayment turns a payment from userID to toUser into one
+// settlement per shared group, based on debts from userGroupDebts
+func allocateCrossGroupPayment(debts []groupDebt, userID, toUser primitive.ObjectID, req models.CrossGroupPaymentRequest, allocationID primitive.ObjectID) ([]models.Settlement, models.Money, error) {
+	// Only groups where the user may record payments, in the chosen currency
+	currency := strings.ToUpper(req.Currency)
+	var owe, owed []groupDebt
+	currencies := map[string]bool{}
+	for _, debt := range debts {
+		if debt.Counterparty != toUser || !debt.Group.HasRole(userID, models.RoleMember) {
+			continue
+		}
+		currencies[debt.Group.Currency()] = true
+		if currency != "" && debt.Group.Currency() != currency {
+			continue
+		}
+		if debt.Amount > 0 {
+			owe = append(owe, debt)
+		} else {
+			owed = append(owed, debt)
+		}
+	}
+	if currency == "" && len(currencies) > 1 {
+		return nil, 0, &paymentRejection{gin.H{"error": "You share groups in several currencies with this person; pass currency"}}
+	}
+
+	var totalOwe, totalOwed models.Money
+	for _, debt := range owe {
+		totalOwe += debt.Amount
+	}
+	for _, debt := range owed {
+		totalOwed -= debt.Amount
+	}
+	net := totalOwe - totalOwed
+	if net <= 0 {
+		return nil, 0, &paymentRejection{gin.H{"error": "You do not owe this person anything", "net": net}}
+	}
+
+	amount := req.Amount
+	if amount == 0 {
+		amount = net
+	}
+	if amount > net {
+		return nil, 0, &paymentRejection{gin.H{"error": "Amount exceeds what you owe this person", "net": net}}
+	}
+
+	note := req.Note
+	if note == "" {
+		note = "Cross-group payment"
+	}
+	now := time.Now()
+	newSettlement := func(group *models.Group, from, to primitive.ObjectID, amount models.Money) models.Settlement {
+		return models.Settlement{
+			ID:           primitive.NewObjectID(),
+			GroupID:      group.ID,
+			FromUser:     from,
+			ToUser:       to,
+			Amount:       amount,
+			Currency:     group.Currency(),
+			Note:         note,
+			AllocationID: &allocationID,
+			CreatedBy:    userID,
+			CreatedAt:    now,
+		}
+	}
+
+	var settlements []models.Settlement
+	for _, debt := range owed {
+		settlements = append(settlements, newSettlement(debt.Group, toUser, userID, -debt.Amount))
+	}
+	slices.SortStableFunc(owe, func(a, b groupDebt) int { return cmp.Compare(b.Amount, a.Amount) })
+	remaining := amount + totalOwed
+	for _, debt := range owe {
+		if remaining == 0 {
+			break
+		}
+		paid := min(remaining, debt.Amount)
+		settlements = append(settlements, newSettlement(debt.Group, userID, toUser, paid))
+		remaining -= paid
+	}
+	return settlements, amount, nil
+}
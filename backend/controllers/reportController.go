@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"expensetracker/models"
+	"expensetracker/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetGroupReport summarizes a group's spending by category, payer, member
+// share and month. It takes the same filters as GetGroupExpenses, usually
+// just from and to.
+func GetGroupReport(c *gin.Context) {
+	group := groupFromContext(c)
+
+	query, err := parseExpenseQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query.GroupID = group.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := repository.Get().Expenses.Report(ctx, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	names := map[primitive.ObjectID]string{}
+	byUser := func(totals []models.ExpenseTotal) []gin.H {
+		rows := []gin.H{}
+		for _, total := range totals {
+			userID, _ := primitive.ObjectIDFromHex(total.Key)
+			rows = append(rows, gin.H{
+				"userId": userID,
+				"name":   participantName(ctx, group, userID, names),
+				"total":  total.Total,
+				"count":  total.Count,
+			})
+		}
+		return rows
+	}
+	byKey := func(totals []models.ExpenseTotal, key string) []gin.H {
+		rows := []gin.H{}
+		for _, total := range totals {
+			rows = append(rows, gin.H{key: total.Key, "total": total.Total, "count": total.Count})
+		}
+		return rows
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency":   group.Currency(),
+		"total":      report.Total,
+		"count":      report.Count,
+		"byCategory": byKey(report.ByCategory, "category"),
+		"byPayer":    byUser(report.ByPayer),
+		"byMember":   byUser(report.ByMember),
+		"byMonth":    byKey(report.ByMonth, "month"),
+	})
+}
@@ -2,79 +2,430 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"maps"
 	"net/http"
+	"slices"
 	"time"
 
 	"expensetracker/config"
 	"expensetracker/models"
+	"expensetracker/repository"
 	"expensetracker/services"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func GetSettlements(c *gin.Context) {
-	groupIDStr := c.Param("groupId")
-	groupID, err := primitive.ObjectIDFromHex(groupIDStr)
+	group := groupFromContext(c)
+	groupID := group.ID
+
+	algorithm := c.DefaultQuery("algorithm", services.AlgorithmExact)
+	if algorithm != services.AlgorithmExact && algorithm != services.AlgorithmGreedy {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Algorithm must be exact or greedy"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 1. Calculate balances per user for this group, in the group's base currency
+	balances, err := groupBalances(ctx, groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate balances"})
+		return
+	}
+
+	// 2. Pass balances to Settlement Service, under the group's rules. Large groups fall back to the greedy algorithm.
+	transactions, used, err := services.SettleBalances(balances, algorithm, config.ExactSettlementMaxSize(), settlementConstraints(group))
+	if errors.Is(err, services.ErrNoValidSettlement) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No settlement plan satisfies the group's settlement rules", "balances": balances})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate settlements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Optimal settlements calculated",
+		"algorithm":    used,
+		"currency":     group.Currency(),
+		"transactions": transactions,
+		"balances":     balances,
+	})
+}
+
+// settlementConstraints converts the group's settlement rules for the
+// settlement service, or returns nil when it has none
+func settlementConstraints(group *models.Group) *services.SettlementConstraints {
+	rules := group.SettlementRules
+	if rules == nil {
+		return nil
+	}
+	constraints := &services.SettlementConstraints{
+		Blocked:   map[string]map[string]bool{},
+		Preferred: map[string][]string{},
+	}
+	for _, pair := range rules.BlockedPairs {
+		if constraints.Blocked[pair.From.Hex()] == nil {
+			constraints.Blocked[pair.From.Hex()] = map[string]bool{}
+		}
+		constraints.Blocked[pair.From.Hex()][pair.To.Hex()] = true
+	}
+	for _, preferred := range rules.PreferredPayees {
+		for _, payee := range preferred.Payees {
+			constraints.Preferred[preferred.UserID.Hex()] = append(constraints.Preferred[preferred.UserID.Hex()], payee.Hex())
+		}
+	}
+	if rules.Treasurer != nil {
+		constraints.Hub = rules.Treasurer.Hex()
+	}
+	return constraints
+}
+
+// GetSettlementRules returns the group's settlement rules
+func GetSettlementRules(c *gin.Context) {
+	group := groupFromContext(c)
+	rules := group.SettlementRules
+	if rules == nil {
+		rules = &models.SettlementRules{}
+	}
+	c.JSON(http.StatusOK, gin.H{"settlementRules": rules})
+}
+
+// UpdateSettlementRules replaces the group's settlement rules (admin). An
+// empty body removes every rule.
+func UpdateSettlementRules(c *gin.Context) {
+	group := groupFromContext(c)
+
+	var req models.UpdateSettlementRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Rules may name anyone who can appear in the balances
+	participant := func(hex string) (primitive.ObjectID, bool) {
+		id, err := primitive.ObjectIDFromHex(hex)
+		return id, err == nil && group.HasParticipant(id)
+	}
+
+	rules := &models.SettlementRules{}
+	for _, pair := range req.BlockedPairs {
+		from, okFrom := participant(pair.From)
+		to, okTo := participant(pair.To)
+		if !okFrom || !okTo || from == to {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Blocked pairs must name two different people of this group"})
+			return
+		}
+		rules.BlockedPairs = append(rules.BlockedPairs, models.PaymentPair{From: from, To: to})
+	}
+	for _, preferred := range req.PreferredPayees {
+		userID, ok := participant(preferred.UserID)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Preferred payees must belong to people of this group"})
+			return
+		}
+		entry := models.PreferredPayees{UserID: userID}
+		for _, hex := range preferred.Payees {
+			payee, ok := participant(hex)
+			if !ok || payee == userID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Preferred payees must be other people of this group"})
+				return
+			}
+			entry.Payees = append(entry.Payees, payee)
+		}
+		rules.PreferredPayees = append(rules.PreferredPayees, entry)
+	}
+	if req.Treasurer != "" {
+		treasurer, err := primitive.ObjectIDFromHex(req.Treasurer)
+		if err != nil || !group.HasMember(treasurer) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The treasurer must be a member of this group"})
+			return
+		}
+		rules.Treasurer = &treasurer
+	}
+	if rules.IsEmpty() {
+		rules = nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := repository.Get().Groups.SetSettlementRules(ctx, group.ID, rules); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settlement rules"})
+		return
+	}
+
+	if rules == nil {
+		rules = &models.SettlementRules{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Settlement rules updated successfully",
+		"settlementRules": rules,
+	})
+}
+
+func RecordSettlement(c *gin.Context) {
+	userIDStr, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDStr.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.RecordSettlementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	groupID, err := primitive.ObjectIDFromHex(req.GroupID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
 		return
 	}
 
+	fromUser, err := primitive.ObjectIDFromHex(req.FromUser)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payer ID"})
+		return
+	}
+
+	toUser, err := primitive.ObjectIDFromHex(req.ToUser)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipient ID"})
+		return
+	}
+
+	if fromUser == toUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payer and recipient must be different members"})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// 1. Calculate balances per user for this group
-	balances := make(map[string]float64) // UserID (hex string) -> Balance
+	store := repository.Get()
+	group, err := store.Groups.FindByID(ctx, groupID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	if !group.HasMember(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+		return
+	}
+	if !group.HasRole(userID, models.RoleMember) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Viewers cannot record payments"})
+		return
+	}
+	// Guests and former members can still settle what they owed or were owed
+	if !group.HasParticipant(fromUser) || !group.HasParticipant(toUser) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payer and recipient must both be members, guests or former members of this group"})
+		return
+	}
+
+	settlement := models.Settlement{
+		ID:        primitive.NewObjectID(),
+		GroupID:   groupID,
+		FromUser:  fromUser,
+		ToUser:    toUser,
+		Amount:    req.Amount,
+		Currency:  group.Currency(),
+		Note:      req.Note,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
 
-	expenseCollection := config.GetCollection("expenses")
-	cursor, err := expenseCollection.Find(ctx, bson.M{"groupId": groupID})
+	// The payment and its effect on the balances are stored together
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := store.Settlements.Create(ctx, &settlement); err != nil {
+			return err
+		}
+		deltas := services.Balances{}
+		deltas.ApplySettlement(settlement)
+		return applyBalanceChanges(ctx, groupID, deltas)
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expenses"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var expenses []models.Expense
-	if err = cursor.All(ctx, &expenses); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode expenses"})
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Payment recorded successfully",
+		"settlement": settlement,
+	})
+}
+
+func GetSettlementHistory(c *gin.Context) {
+	group := groupFromContext(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Newest payments first
+	settlements, err := repository.Get().Settlements.FindByGroup(ctx, group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments"})
 		return
 	}
 
-	splitCollection := config.GetCollection("splits")
+	c.JSON(http.StatusOK, settlements)
+}
+
+// groupBalances returns the per-user balances of a group in its base
+// currency from the materialized ledger, building the ledger from the full
+// history the first time it is needed.
+// Positive balance = paid more than owed (Creditor). Negative balance = owed more than paid (Debtor).
+func groupBalances(ctx context.Context, groupID primitive.ObjectID) (services.Balances, error) {
+	store := repository.Get()
+	stored, err := store.Balances.FindByGroup(ctx, groupID)
+	if err == nil {
+		return services.Balances(stored.Balances), nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	var balances services.Balances
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		balances, err = rebuildGroupBalances(ctx, groupID)
+		return err
+	})
+	return balances, err
+}
+
+// lockedGroupBalances returns a group's balances from inside a transaction,
+// building the ledger if needed. The ledger document is written first, so
+// the transaction conflicts with any concurrent change to the balances it
+// reads instead of acting on a stale view.
+func lockedGroupBalances(ctx context.Context, groupID primitive.ObjectID) (services.Balances, error) {
+	if err := applyBalanceChanges(ctx, groupID, nil); err != nil {
+		return nil, err
+	}
+	stored, err := repository.Get().Balances.FindByGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return services.Balances(stored.Balances), nil
+}
+
+// computeGroupBalances nets every expense and recorded payment of a group
+// from scratch, ignoring the ledger
+func computeGroupBalances(ctx context.Context, groupID primitive.ObjectID) (services.Balances, error) {
+	store := repository.Get()
+	balances := services.Balances{}
+
+	totals, err := store.Expenses.BalanceTotals(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	balances.ApplyTotals(totals)
+
+	// Fold in payments already made
+	payments, err := store.Settlements.FindByGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	for _, payment := range payments {
+		balances.ApplySettlement(payment)
+	}
+	return balances, nil
+}
+
+// rebuildGroupBalances recomputes a group's ledger from its full history and
+// stores it. Run it inside a transaction.
+func rebuildGroupBalances(ctx context.Context, groupID primitive.ObjectID) (services.Balances, error) {
+	balances, err := computeGroupBalances(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	err = repository.Get().Balances.Replace(ctx, &models.GroupBalance{
+		GroupID:   groupID,
+		Balances:  balances,
+		UpdatedAt: time.Now(),
+	})
+	return balances, err
+}
+
+// RebuildBalances checks the materialized balances of a group against its
+// full history and rebuilds them (admin). With ?dryRun=true it only reports
+// the differences.
+func RebuildBalances(c *gin.Context) {
+	group := groupFromContext(c)
+	dryRun := c.Query("dryRun") == "true"
 
-	// Pre-calculate: Positive balance = paid more than owed (Creditor). Negative balance = owed more than paid (Debtor).
-	for _, exp := range expenses {
-		payerIDHex := exp.PaidBy.Hex()
-		balances[payerIDHex] += exp.Amount
+	store := repository.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var differences []gin.H
+	err := store.WithTransaction(ctx, func(ctx context.Context) error {
+		differences = []gin.H{}
+		var stored map[string]models.Money
+		existing, err := store.Balances.FindByGroup(ctx, group.ID)
+		if err == nil {
+			stored = existing.Balances
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
 
-		// Subtract their splits
-		splitCursor, err := splitCollection.Find(ctx, bson.M{"expenseId": exp.ID})
+		expected, err := computeGroupBalances(ctx, group.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch splits"})
-			return
+			return err
 		}
 
-		var splits []models.Split
-		if err = splitCursor.All(ctx, &splits); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode splits"})
-			return
+		userIDs := make(map[string]bool)
+		for userID := range stored {
+			userIDs[userID] = true
+		}
+		for userID := range expected {
+			userIDs[userID] = true
+		}
+		for _, userID := range slices.Sorted(maps.Keys(userIDs)) {
+			if stored[userID] != expected[userID] {
+				differences = append(differences, gin.H{"userId": userID, "stored": stored[userID], "expected": expected[userID]})
+			}
 		}
 
-		for _, split := range splits {
-			splitUserIDHex := split.UserID.Hex()
-			balances[splitUserIDHex] -= split.Amount
+		if dryRun || (existing != nil && len(differences) == 0) {
+			return nil
 		}
-		splitCursor.Close(ctx)
+		_, err = rebuildGroupBalances(ctx, group.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild balances"})
+		return
 	}
 
-	// 2. Pass balances to Settlement Service (Greedy Algorithm)
-	transactions := services.CalculateOptimalSettlements(balances)
-
 	c.JSON(http.StatusOK, gin.H{
-		"message":      "Optimal settlements calculated",
-		"transactions": transactions,
-		"balances":     balances,
+		"consistent":  len(differences) == 0,
+		"differences": differences,
+		"rebuilt":     !dryRun && len(differences) > 0,
 	})
 }
+
+// applyBalanceChanges adds the balance changes of an expense or payment to
+// the group's ledger. Run it in the transaction that writes the change, after
+// the change itself: a group without a ledger gets one built from its full
+// history, which already includes the change. Both paths write the ledger
+// document, even when every delta is zero, so this transaction conflicts
+// with a concurrent lazy rebuild in groupBalances and neither can store
+// balances missing the other's view.
+func applyBalanceChanges(ctx context.Context, groupID primitive.ObjectID, deltas services.Balances) error {
+	err := repository.Get().Balances.Apply(ctx, groupID, deltas)
+	if errors.Is(err, repository.ErrNotFound) {
+		_, err = rebuildGroupBalances(ctx, groupID)
+	}
+	return err
+}
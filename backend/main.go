@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"expensetracker/config"
+	"expensetracker/repository"
 	"expensetracker/routes"
 
 	"github.com/gin-contrib/cors"
@@ -20,14 +23,28 @@ func main() {
 		log.Println("No .env file found, assuming environment variables are set")
 	}
 
-	// Connect to Database if valid URI is present
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI != "" && !strings.Contains(mongoURI, "<username>:<password>") {
-		config.ConnectDB()
+	// STORAGE=memory keeps all data in process memory, for local development and tests
+	if os.Getenv("STORAGE") == "memory" {
+		log.Println("Using in-memory storage. Data will be lost when the server stops.")
+		repository.Init(repository.NewMemoryStore())
 	} else {
-		log.Println("⚠️ WARNING: Invalid or default MONGO_URI in .env")
-		log.Println("⚠️ Database is NOT connected. APIs will return 500 errors.")
-		log.Println("⚠️ Please update backend/.env with your real MongoDB Atlas connection string.")
+		// Connect to Database if valid URI is present
+		mongoURI := os.Getenv("MONGO_URI")
+		if mongoURI != "" && !strings.Contains(mongoURI, "<username>:<password>") {
+			config.ConnectDB()
+		} else {
+			log.Println("⚠️ WARNING: Invalid or default MONGO_URI in .env")
+			log.Println("⚠️ Database is NOT connected. APIs will return 500 errors.")
+			log.Println("⚠️ Please update backend/.env with your real MongoDB Atlas connection string, or set STORAGE=memory.")
+		}
+		if config.DB != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := repository.EnsureMongoIndexes(ctx, config.DB); err != nil {
+				log.Printf("Failed to create MongoDB indexes: %v", err)
+			}
+			cancel()
+			repository.Init(repository.NewMongoStore(config.DB))
+		}
 	}
 
 	// Initialize Gin router
@@ -52,6 +69,8 @@ func main() {
 	routes.SetupGroupRoutes(r)
 	routes.SetupExpenseRoutes(r)
 	routes.SetupSettlementRoutes(r)
+	routes.SetupFXRateRoutes(r)
+	routes.SetupInvitationRoutes(r)
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"expensetracker/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SystemAdmin rejects the request unless the authenticated user is listed in
+// ADMIN_USER_IDS. It must run after AuthMiddleware.
+func SystemAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.IsSystemAdmin(c.GetString("userID")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action requires a system administrator"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"time"
+
+	"expensetracker/repository"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -42,13 +46,41 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			userID := claims["user_id"].(string)
-			c.Set("userID", userID)
-			c.Next()
-		} else {
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			c.Abort()
+			return
+		}
+
+		userID, _ := claims["user_id"].(string)
+		tokenID, _ := claims["jti"].(string)
+		tokenType, _ := claims["type"].(string)
+		expiresAt, err := claims.GetExpirationTime()
+		if userID == "" || tokenID == "" || tokenType != "access" || err != nil || expiresAt == nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		revoked, err := repository.Get().Tokens.IsAccessTokenRevoked(ctx, tokenID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
 		}
+
+		c.Set("userID", userID)
+		c.Set("tokenID", tokenID)
+		c.Set("tokenExpiry", expiresAt.Time)
+		c.Next()
 	}
 }
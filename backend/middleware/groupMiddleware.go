@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"expensetracker/models"
+	"expensetracker/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GroupMember loads the group named by the given route parameter and rejects
+// the request unless the authenticated user is one of its members. The loaded
+// *models.Group is stored on the context under "group". It must run after
+// AuthMiddleware.
+func GroupMember(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupID, err := primitive.ObjectIDFromHex(c.Param(param))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+			c.Abort()
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		group, err := repository.Get().Groups.FindByID(ctx, groupID)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group"})
+			c.Abort()
+			return
+		}
+
+		if !group.HasMember(userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+			c.Abort()
+			return
+		}
+
+		c.Set("group", group)
+		c.Next()
+	}
+}
+
+// GroupRole rejects the request unless the authenticated user holds at least
+// the given role in the group loaded by GroupMember
+func GroupRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := c.MustGet("group").(*models.Group)
+		userID, _ := primitive.ObjectIDFromHex(c.GetString("userID"))
+
+		if !group.HasRole(userID, role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action requires the " + role + " role"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GroupBalance is the materialized net balance of everyone in a group, in the
+// group's base currency. It is adjusted whenever an expense or payment
+// changes, so balances do not have to be recomputed from the full history.
+type GroupBalance struct {
+	GroupID   primitive.ObjectID `bson:"_id" json:"groupId"`
+	Balances  map[string]Money   `bson:"balances" json:"balances"` // User ID (hex) -> net balance
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import "slices"
+
+// DefaultCategories are available in every group, next to its own custom
+// categories. Categories are stored lower-cased.
+var DefaultCategories = []string{
+	"food",
+	"groceries",
+	"transport",
+	"accommodation",
+	"entertainment",
+	"shopping",
+	"utilities",
+	"rent",
+	"health",
+	"travel",
+	"other",
+}
+
+// Limits on the tags of one expense
+const (
+	MaxExpenseTags = 20
+	MaxTagLength   = 40
+)
+
+// Ways of grouping expense totals
+const (
+	ExpenseGroupCategory = "category"
+	ExpenseGroupTag      = "tag"
+)
+
+// ExpenseTotal sums the expenses sharing a category or tag, in the group's
+// base currency. Key is "" for expenses without a category.
+type ExpenseTotal struct {
+	Key   string `bson:"_id" json:"key"`
+	Total Money  `bson:"total" json:"total"`
+	Count int    `bson:"count" json:"count"`
+}
+
+// ExpenseReport summarizes a group's spending, in its base currency
+type ExpenseReport struct {
+	Total      Money          `bson:"total" json:"total"`
+	Count      int            `bson:"count" json:"count"`
+	ByCategory []ExpenseTotal `bson:"byCategory" json:"byCategory"`
+	ByPayer    []ExpenseTotal `bson:"byPayer" json:"byPayer"`   // Key is a user ID; Total is what they paid, Count how many expenses they paid for
+	ByMember   []ExpenseTotal `bson:"byMember" json:"byMember"` // Key is a user ID; Total is their share, Count how many expenses they shared
+	ByMonth    []ExpenseTotal `bson:"byMonth" json:"byMonth"`   // Key is the month as YYYY-MM (UTC), oldest first
+}
+
+// CategoryCatalogue returns the categories expenses of the group can use:
+// the defaults followed by the group's custom ones
+func (g *Group) CategoryCatalogue() []string {
+	return append(slices.Clone(DefaultCategories), g.CustomCategories...)
+}
+
+// HasCategory reports whether a lower-cased category is in the group's catalogue
+func (g *Group) HasCategory(category string) bool {
+	return slices.Contains(DefaultCategories, category) || slices.Contains(g.CustomCategories, category)
+}
+
+type AddCategoryRequest struct {
+	Name string `json:"name" binding:"required,max=40"`
+}
@@ -1,35 +1,272 @@
 package models
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Expense struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	GroupID     primitive.ObjectID `bson:"groupId" json:"groupId"`
-	PaidBy      primitive.ObjectID `bson:"paidBy" json:"paidBy"`
-	Amount      float64            `bson:"amount" json:"amount" validate:"required"`
-	Description string             `bson:"description" json:"description" validate:"required"`
-	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	GroupID     primitive.ObjectID  `bson:"groupId" json:"groupId"`
+	PaidBy      primitive.ObjectID  `bson:"paidBy" json:"paidBy"`                     // Main payer, the one who contributed the most
+	Payers      []PayerContribution `bson:"payers,omitempty" json:"payers,omitempty"` // Set when several people paid; empty means PaidBy paid everything
+	Amount      Money               `bson:"amount" json:"amount" validate:"required"`
+	Currency    string              `bson:"currency,omitempty" json:"currency"` // ISO 4217 code; empty on expenses logged before multi-currency support
+	BaseAmount  Money               `bson:"baseAmount" json:"baseAmount"`       // Amount converted into the group's base currency
+	FXRate      float64             `bson:"fxRate,omitempty" json:"fxRate,omitempty"`
+	Description string              `bson:"description" json:"description" validate:"required"`
+	SplitType   string              `bson:"splitType" json:"splitType"`
+	Category    string              `bson:"category,omitempty" json:"category,omitempty"`
+	Tags        []string            `bson:"tags,omitempty" json:"tags,omitempty"` // Free-form, lower-cased
+	CreatedBy   primitive.ObjectID  `bson:"createdBy,omitempty" json:"createdBy"` // Member who logged the expense, not necessarily a payer
+	Date        time.Time           `bson:"date" json:"date"`                     // When the expense happened; decides the exchange rate
+	CreatedAt   time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   *time.Time          `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+}
+
+// PayerContribution is the part of an expense one person paid
+type PayerContribution struct {
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	Amount     Money              `bson:"amount" json:"amount"`
+	BaseAmount Money              `bson:"baseAmount" json:"baseAmount"` // Amount in the group's base currency
 }
 
 type Split struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ExpenseID  primitive.ObjectID `bson:"expenseId" json:"expenseId"`
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	Amount     Money              `bson:"amount" json:"amount"`
+	BaseAmount Money              `bson:"baseAmount" json:"baseAmount"` // Amount in the group's base currency
+}
+
+// InBaseCurrency reports whether the expense was stored before currencies were
+// tracked, in which case its amounts are already in the group's base currency
+func (e *Expense) InBaseCurrency() bool {
+	return e.Currency == ""
+}
+
+// IsPayer reports whether userID paid for (part of) the expense
+func (e *Expense) IsPayer(userID primitive.ObjectID) bool {
+	if e.PaidBy == userID {
+		return true
+	}
+	for _, payer := range e.Payers {
+		if payer.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// ReassignPayer replaces from with to as payer of the expense. When both
+// contributed, their contributions are combined into one.
+func (e *Expense) ReassignPayer(from, to primitive.ObjectID) {
+	if e.PaidBy == from {
+		e.PaidBy = to
+	}
+	payers := e.Payers[:0]
+	merged := -1
+	for _, payer := range e.Payers {
+		if payer.UserID == from {
+			payer.UserID = to
+		}
+		if payer.UserID != to {
+			payers = append(payers, payer)
+			continue
+		}
+		if merged >= 0 {
+			payers[merged].Amount += payer.Amount
+			payers[merged].BaseAmount += payer.BaseAmount
+			continue
+		}
+		merged = len(payers)
+		payers = append(payers, payer)
+	}
+	e.Payers = payers
+}
+
+// ExpenseDate returns when the expense happened, falling back to when it was
+// logged for expenses stored before dates were tracked
+func (e *Expense) ExpenseDate() time.Time {
+	if e.Date.IsZero() {
+		return e.CreatedAt
+	}
+	return e.Date
+}
+
+// BaseTotal returns the amount of the expense in the group's base currency
+func (e *Expense) BaseTotal() Money {
+	if e.InBaseCurrency() {
+		return e.Amount
+	}
+	return e.BaseAmount
+}
+
+// BasePaid returns what each payer contributed, with BaseAmount in the
+// group's base currency
+func (e *Expense) BasePaid() []PayerContribution {
+	switch {
+	case e.InBaseCurrency():
+		return []PayerContribution{{UserID: e.PaidBy, Amount: e.Amount, BaseAmount: e.Amount}}
+	case len(e.Payers) == 0:
+		return []PayerContribution{{UserID: e.PaidBy, Amount: e.Amount, BaseAmount: e.BaseAmount}}
+	default:
+		return e.Payers
+	}
+}
+
+// BaseOwed returns the share of a split of this expense in the group's base currency
+func (e *Expense) BaseOwed(split Split) Money {
+	if e.InBaseCurrency() {
+		return split.Amount
+	}
+	return split.BaseAmount
+}
+
+// UserTotals is how much one person paid and owes over a group's expenses,
+// in the group's base currency
+type UserTotals struct {
+	UserID primitive.ObjectID `bson:"_id" json:"userId"`
+	Paid   Money              `bson:"paid" json:"paid"`
+	Owed   Money              `bson:"owed" json:"owed"`
+}
+
+// Sort orders accepted by ExpenseQuery
+const (
+	ExpenseSortDate      = "date"
+	ExpenseSortAmount    = "amount"
+	ExpenseSortCreatedAt = "createdAt"
+)
+
+// ExpenseQuery selects a page of a group's expenses. Nil and empty fields
+// do not filter.
+type ExpenseQuery struct {
+	GroupID    primitive.ObjectID
+	PaidBy     *primitive.ObjectID // Main payer or any contributor
+	DateFrom   *time.Time          // Inclusive
+	DateBefore *time.Time          // Exclusive
+	MinAmount  *Money              // Inclusive, in the group's base currency
+	MaxAmount  *Money              // Inclusive, in the group's base currency
+	Category   string
+	Tag        string
+	Text       string // Case-insensitive substring of the description
+	SortBy     string // One of the ExpenseSort constants
+	Ascending  bool
+	After      *ExpenseCursor // Continue after this expense
+	Limit      int
+}
+
+// SortValue returns the value the expense is ordered by: Unix milliseconds
+// for dates, cents for amounts
+func (e *Expense) SortValue(sortBy string) int64 {
+	switch sortBy {
+	case ExpenseSortAmount:
+		return int64(e.BaseTotal())
+	case ExpenseSortCreatedAt:
+		return e.CreatedAt.UnixMilli()
+	default:
+		return e.ExpenseDate().UnixMilli()
+	}
+}
+
+// ExpenseCursor points just past the last expense of a page
+type ExpenseCursor struct {
+	SortBy string             `json:"s"`
+	Value  int64              `json:"v"` // SortValue of the last expense
+	ID     primitive.ObjectID `json:"id"`
+}
+
+// NewExpenseCursor returns the cursor continuing after expense
+func NewExpenseCursor(expense *Expense, sortBy string) ExpenseCursor {
+	return ExpenseCursor{SortBy: sortBy, Value: expense.SortValue(sortBy), ID: expense.ID}
+}
+
+// Encode returns the cursor as an opaque URL-safe string
+func (c ExpenseCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeExpenseCursor parses a cursor produced by Encode
+func DecodeExpenseCursor(s string) (*ExpenseCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor ExpenseCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID.IsZero() {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// Actions recorded in the expense history
+const (
+	RevisionUpdated = "updated"
+	RevisionDeleted = "deleted"
+)
+
+// ExpenseRevision is a snapshot of an expense and its splits taken right
+// before it was edited or deleted
+type ExpenseRevision struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	ExpenseID primitive.ObjectID `bson:"expenseId" json:"expenseId"`
-	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
-	Amount    float64            `bson:"amount" json:"amount"`
+	GroupID   primitive.ObjectID `bson:"groupId" json:"groupId"`
+	Action    string             `bson:"action" json:"action"`
+	Expense   Expense            `bson:"expense" json:"expense"`
+	Splits    []Split            `bson:"splits" json:"splits"`
+	ChangedBy primitive.ObjectID `bson:"changedBy" json:"changedBy"`
+	ChangedAt time.Time          `bson:"changedAt" json:"changedAt"`
 }
 
 // Balance struct for response mappings later
 type NetBalance struct {
 	UserID primitive.ObjectID `json:"userId"`
-	Amount float64            `json:"amount"` // Positive means they get money, negative means they owe
+	Amount Money              `json:"amount"` // Positive means they get money, negative means they owe
+}
+
+// PayerInput is one person's contribution when several people paid an expense
+type PayerInput struct {
+	UserID string `json:"userId" binding:"required"`
+	Amount Money  `json:"amount" binding:"required,gt=0"`
+}
+
+// SplitParticipant is one person sharing an expense. Only the field matching
+// the request's split type is used: amount (exact), percentage or shares.
+type SplitParticipant struct {
+	UserID     string  `json:"userId" binding:"required"`
+	Amount     Money   `json:"amount"`
+	Percentage float64 `json:"percentage"`
+	Shares     float64 `json:"shares"`
 }
 
 type AddExpenseRequest struct {
-	GroupID     string  `json:"groupId" binding:"required"`
-	Amount      float64 `json:"amount" binding:"required,gt=0"`
-	Description string  `json:"description" binding:"required"`
+	GroupID      string             `json:"groupId" binding:"required"`
+	Amount       Money              `json:"amount" binding:"required,gt=0"`
+	Currency     string             `json:"currency"` // Defaults to the group's base currency
+	Date         string             `json:"date"`     // YYYY-MM-DD or RFC 3339, defaults to now
+	Description  string             `json:"description" binding:"required"`
+	PaidBy       string             `json:"paidBy"`                                // Member who paid everything, defaults to the caller
+	Payers       []PayerInput       `json:"payers" binding:"omitempty,dive"`       // Several payers instead of PaidBy
+	SplitType    string             `json:"splitType"`                             // equal (default), exact, percentage or shares
+	Category     string             `json:"category"`                              // One of the group's categories, stored lower-cased
+	Tags         []string           `json:"tags"`                                  // Optional free-form labels
+	Participants []SplitParticipant `json:"participants" binding:"omitempty,dive"` // Defaults to every group member
+}
+
+type UpdateExpenseRequest struct {
+	Amount       Money              `json:"amount" binding:"required,gt=0"`
+	Currency     string             `json:"currency"`
+	Date         string             `json:"date"`
+	Description  string             `json:"description" binding:"required"`
+	PaidBy       string             `json:"paidBy"`
+	Payers       []PayerInput       `json:"payers" binding:"omitempty,dive"`
+	SplitType    string             `json:"splitType"`
+	Category     *string            `json:"category"` // Replaces the category when given; "" removes it
+	Tags         []string           `json:"tags"`     // Replaces the tags when given
+	Participants []SplitParticipant `json:"participants" binding:"omitempty,dive"`
 }
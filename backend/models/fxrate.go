@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FXRate states that one unit of Base was worth Rate units of Quote on Date
+type FXRate struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Base      string             `bson:"base" json:"base"`
+	Quote     string             `bson:"quote" json:"quote"`
+	Rate      float64            `bson:"rate" json:"rate"`
+	Date      time.Time          `bson:"date" json:"date"` // Day the rate applies from, at midnight UTC
+	Source    string             `bson:"source" json:"source"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+type FXRateInput struct {
+	Base  string  `json:"base" binding:"required,len=3"`
+	Quote string  `json:"quote" binding:"required,len=3"`
+	Rate  float64 `json:"rate" binding:"required,gt=0"`
+	Date  string  `json:"date" binding:"required"` // YYYY-MM-DD
+}
+
+type UploadFXRatesRequest struct {
+	Rates []FXRateInput `json:"rates" binding:"required,min=1,dive"`
+}
@@ -1,23 +1,324 @@
 package models
 
 import (
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Group struct {
-	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	Name      string               `bson:"name" json:"name" validate:"required"`
-	CreatedBy primitive.ObjectID   `bson:"createdBy" json:"createdBy"`
-	Members   []primitive.ObjectID `bson:"members" json:"members"`
-	CreatedAt time.Time            `bson:"createdAt" json:"createdAt"`
+	ID               primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name             string               `bson:"name" json:"name" validate:"required"`
+	BaseCurrency     string               `bson:"baseCurrency,omitempty" json:"baseCurrency"` // ISO 4217 code every balance is settled in
+	CreatedBy        primitive.ObjectID   `bson:"createdBy" json:"createdBy"`
+	Members          []primitive.ObjectID `bson:"members" json:"members"`
+	Roles            map[string]string    `bson:"roles,omitempty" json:"roles"`                           // Member ID (hex) -> role
+	FormerMembers    []primitive.ObjectID `bson:"formerMembers,omitempty" json:"formerMembers,omitempty"` // Left or removed; their history still counts
+	Guests           []GuestMember        `bson:"guests,omitempty" json:"guests,omitempty"`               // People without an account
+	SettlementRules  *SettlementRules     `bson:"settlementRules,omitempty" json:"settlementRules,omitempty"`
+	CustomCategories []string             `bson:"customCategories,omitempty" json:"customCategories,omitempty"` // Added to DefaultCategories, lower-cased
+	CreatedAt        time.Time            `bson:"createdAt" json:"createdAt"`
+}
+
+// GuestMember stands in for someone who will not sign up. Guests can pay and
+// owe like members but cannot log in; their ID is used wherever a user ID
+// would be, until they are merged into a registered user.
+type GuestMember struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	AddedBy   primitive.ObjectID `bson:"addedBy" json:"addedBy"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// SettlementRules constrain the payments suggested to settle the group
+type SettlementRules struct {
+	BlockedPairs    []PaymentPair       `bson:"blockedPairs,omitempty" json:"blockedPairs"`       // Payments that cannot be made, e.g. for lack of bank details
+	PreferredPayees []PreferredPayees   `bson:"preferredPayees,omitempty" json:"preferredPayees"` // Who someone would rather pay
+	Treasurer       *primitive.ObjectID `bson:"treasurer,omitempty" json:"treasurer,omitempty"`   // When set, everyone pays or is paid by the treasurer only
+}
+
+// PaymentPair is a payment from one person to another
+type PaymentPair struct {
+	From primitive.ObjectID `bson:"from" json:"from"`
+	To   primitive.ObjectID `bson:"to" json:"to"`
+}
+
+// PreferredPayees lists the people UserID would rather pay, most preferred first
+type PreferredPayees struct {
+	UserID primitive.ObjectID   `bson:"userId" json:"userId"`
+	Payees []primitive.ObjectID `bson:"payees" json:"payees"`
+}
+
+// Names reports whether any rule involves userID
+func (r *SettlementRules) Names(userID primitive.ObjectID) bool {
+	if r == nil {
+		return false
+	}
+	for _, pair := range r.BlockedPairs {
+		if pair.From == userID || pair.To == userID {
+			return true
+		}
+	}
+	for _, preferred := range r.PreferredPayees {
+		if preferred.UserID == userID || slices.Contains(preferred.Payees, userID) {
+			return true
+		}
+	}
+	return r.Treasurer != nil && *r.Treasurer == userID
+}
+
+// WithoutUser returns a copy of the rules with every rule naming userID
+// dropped, or nil when no rule is left
+func (r *SettlementRules) WithoutUser(userID primitive.ObjectID) *SettlementRules {
+	if r == nil {
+		return nil
+	}
+	rules := &SettlementRules{}
+	for _, pair := range r.BlockedPairs {
+		if pair.From != userID && pair.To != userID {
+			rules.BlockedPairs = append(rules.BlockedPairs, pair)
+		}
+	}
+	for _, preferred := range r.PreferredPayees {
+		if preferred.UserID == userID {
+			continue
+		}
+		entry := PreferredPayees{UserID: preferred.UserID}
+		for _, payee := range preferred.Payees {
+			if payee != userID {
+				entry.Payees = append(entry.Payees, payee)
+			}
+		}
+		if len(entry.Payees) > 0 {
+			rules.PreferredPayees = append(rules.PreferredPayees, entry)
+		}
+	}
+	if r.Treasurer != nil && *r.Treasurer != userID {
+		treasurer := *r.Treasurer
+		rules.Treasurer = &treasurer
+	}
+	if rules.IsEmpty() {
+		return nil
+	}
+	return rules
+}
+
+// ReassignUser returns a copy of the rules with from replaced by to. Rules
+// that would then name to twice are dropped and preferences of both are
+// combined, to's first. It returns nil when no rule is left.
+func (r *SettlementRules) ReassignUser(from, to primitive.ObjectID) *SettlementRules {
+	if r == nil {
+		return nil
+	}
+	replace := func(id primitive.ObjectID) primitive.ObjectID {
+		if id == from {
+			return to
+		}
+		return id
+	}
+
+	rules := &SettlementRules{}
+	for _, pair := range r.BlockedPairs {
+		pair = PaymentPair{From: replace(pair.From), To: replace(pair.To)}
+		if pair.From != pair.To && !slices.Contains(rules.BlockedPairs, pair) {
+			rules.BlockedPairs = append(rules.BlockedPairs, pair)
+		}
+	}
+	// Walk to's own preferences before the ones moved over from from
+	preferences := slices.Clone(r.PreferredPayees)
+	slices.SortStableFunc(preferences, func(a, b PreferredPayees) int {
+		switch {
+		case a.UserID == to && b.UserID != to:
+			return -1
+		case b.UserID == to && a.UserID != to:
+			return 1
+		}
+		return 0
+	})
+	for _, preferred := range preferences {
+		userID := replace(preferred.UserID)
+		i := slices.IndexFunc(rules.PreferredPayees, func(entry PreferredPayees) bool { return entry.UserID == userID })
+		if i < 0 {
+			rules.PreferredPayees = append(rules.PreferredPayees, PreferredPayees{UserID: userID})
+			i = len(rules.PreferredPayees) - 1
+		}
+		entry := &rules.PreferredPayees[i]
+		for _, payee := range preferred.Payees {
+			payee = replace(payee)
+			if payee != userID && !slices.Contains(entry.Payees, payee) {
+				entry.Payees = append(entry.Payees, payee)
+			}
+		}
+	}
+	rules.PreferredPayees = slices.DeleteFunc(rules.PreferredPayees, func(entry PreferredPayees) bool { return len(entry.Payees) == 0 })
+	if r.Treasurer != nil {
+		treasurer := replace(*r.Treasurer)
+		rules.Treasurer = &treasurer
+	}
+	if rules.IsEmpty() {
+		return nil
+	}
+	return rules
+}
+
+// IsEmpty reports whether the rules constrain nothing
+func (r *SettlementRules) IsEmpty() bool {
+	return r == nil || len(r.BlockedPairs) == 0 && len(r.PreferredPayees) == 0 && r.Treasurer == nil
+}
+
+// DefaultCurrency is the base currency of groups created without one
+const DefaultCurrency = "INR"
+
+// Currency returns the group's base currency
+func (g *Group) Currency() string {
+	if g.BaseCurrency == "" {
+		return DefaultCurrency
+	}
+	return g.BaseCurrency
+}
+
+// Guest returns the guest with the given ID, or nil
+func (g *Group) Guest(guestID primitive.ObjectID) *GuestMember {
+	for i := range g.Guests {
+		if g.Guests[i].ID == guestID {
+			return &g.Guests[i]
+		}
+	}
+	return nil
+}
+
+// CanShareExpenses reports whether userID can pay for or owe a share of new
+// expenses: any current member or guest
+func (g *Group) CanShareExpenses(userID primitive.ObjectID) bool {
+	return g.HasMember(userID) || g.Guest(userID) != nil
+}
+
+// SharingIDs returns everyone who shares expenses by default: the members
+// followed by the guests
+func (g *Group) SharingIDs() []primitive.ObjectID {
+	ids := append([]primitive.ObjectID{}, g.Members...)
+	for _, guest := range g.Guests {
+		ids = append(ids, guest.ID)
+	}
+	return ids
+}
+
+// HasParticipant reports whether userID is a current or former member or a
+// guest, i.e. someone who may appear in the group's expenses and payments
+func (g *Group) HasParticipant(userID primitive.ObjectID) bool {
+	if g.CanShareExpenses(userID) {
+		return true
+	}
+	for _, formerID := range g.FormerMembers {
+		if formerID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Group roles, from most to least privileged. Owners can do everything,
+// including managing admins; admins manage members and edit any expense;
+// members log expenses and payments; viewers can only read.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleMember: 2, RoleAdmin: 3, RoleOwner: 4}
+
+// Role returns the role of userID in the group, or "" if they are not a
+// member. Groups created before roles existed have no Roles entries: their
+// creator is the owner and everyone else a member.
+func (g *Group) Role(userID primitive.ObjectID) string {
+	if !g.HasMember(userID) {
+		return ""
+	}
+	if role, ok := g.Roles[userID.Hex()]; ok {
+		return role
+	}
+	if userID == g.CreatedBy {
+		return RoleOwner
+	}
+	return RoleMember
+}
+
+// HasRole reports whether userID is a member with at least the given role
+func (g *Group) HasRole(userID primitive.ObjectID, role string) bool {
+	return roleRank[g.Role(userID)] >= roleRank[role]
+}
+
+// Owner returns the ID of the group's owner
+func (g *Group) Owner() primitive.ObjectID {
+	for _, memberID := range g.Members {
+		if g.Role(memberID) == RoleOwner {
+			return memberID
+		}
+	}
+	return g.CreatedBy
+}
+
+// MemberRoles returns the role of every member, including the defaults of
+// members without an explicit entry
+func (g *Group) MemberRoles() map[string]string {
+	roles := make(map[string]string, len(g.Members))
+	for _, memberID := range g.Members {
+		roles[memberID.Hex()] = g.Role(memberID)
+	}
+	return roles
 }
 
 type CreateGroupRequest struct {
-	Name string `json:"name" binding:"required"`
+	Name         string `json:"name" binding:"required"`
+	BaseCurrency string `json:"baseCurrency"` // Defaults to DefaultCurrency
 }
 
 type AddMemberRequest struct {
 	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"omitempty,oneof=admin member viewer"` // Defaults to member
+}
+
+type AddGuestRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type MergeGuestRequest struct {
+	UserID string `json:"userId" binding:"required"`
+}
+
+type UpdateGroupRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type UpdateSettlementRulesRequest struct {
+	BlockedPairs []struct {
+		From string `json:"from" binding:"required"`
+		To   string `json:"to" binding:"required"`
+	} `json:"blockedPairs"`
+	PreferredPayees []struct {
+		UserID string   `json:"userId" binding:"required"`
+		Payees []string `json:"payees" binding:"required"`
+	} `json:"preferredPayees"`
+	Treasurer string `json:"treasurer"` // Empty turns hub mode off
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin member viewer"`
+}
+
+type TransferOwnershipRequest struct {
+	UserID string `json:"userId" binding:"required"`
+}
+
+// HasMember reports whether userID is listed in the group's members
+func (g *Group) HasMember(userID primitive.ObjectID) bool {
+	for _, memberID := range g.Members {
+		if memberID == userID {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invitation lets someone join a group by email, including people who have
+// not registered yet. It is accepted through a signed, expiring invite token
+// or automatically when the invited email signs up.
+type Invitation struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	GroupID    primitive.ObjectID  `bson:"groupId" json:"groupId"`
+	Email      string              `bson:"email" json:"email"` // Lower-cased
+	Role       string              `bson:"role" json:"role"`
+	InvitedBy  primitive.ObjectID  `bson:"invitedBy" json:"invitedBy"`
+	ExpiresAt  time.Time           `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+	AcceptedAt *time.Time          `bson:"acceptedAt,omitempty" json:"acceptedAt,omitempty"`
+	AcceptedBy *primitive.ObjectID `bson:"acceptedBy,omitempty" json:"acceptedBy,omitempty"`
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"omitempty,oneof=admin member viewer"` // Defaults to member
+}
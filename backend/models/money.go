@@ -0,0 +1,196 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Money is an amount in minor units (cents). It is stored in MongoDB as an
+// int64 and exchanged over JSON as a decimal number with two fraction digits,
+// so 1234 cents is sent and received as 12.34.
+type Money int64
+
+// ParseMoney parses a decimal string such as "12.34" or "-5" into Money.
+// More than two fraction digits are rejected instead of being rounded.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("empty amount")
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" && (!hasFrac || frac == "") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("amount %q has more than two decimal places", s)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units < 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil || cents < 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if units > (math.MaxInt64-cents)/100 {
+		return 0, fmt.Errorf("amount %q is too large", s)
+	}
+
+	value := units*100 + cents
+	if negative {
+		value = -value
+	}
+	return Money(value), nil
+}
+
+// String formats the amount as a decimal with two fraction digits
+func (m Money) String() string {
+	value := int64(m)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, value/100, value%100)
+}
+
+// Abs returns the absolute value of m
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts both JSON numbers and numeric strings
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "null" {
+		return nil
+	}
+	// Plain JSON numbers may arrive in exponent form, e.g. 1e2
+	if strings.ContainsAny(text, "eE") {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("invalid amount %s", text)
+		}
+		text = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bsontype.Int64, bsoncore.AppendInt64(nil, int64(m)), nil
+}
+
+// UnmarshalBSONValue reads integer cents. Documents written before amounts
+// were stored as integers hold a double in major units, which is converted.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bsoncore.Value{Type: t, Data: data}
+	switch t {
+	case bsontype.Int64:
+		*m = Money(value.Int64())
+	case bsontype.Int32:
+		*m = Money(value.Int32())
+	case bsontype.Double:
+		*m = Money(math.Round(value.Double() * 100))
+	case bsontype.Null, bsontype.Undefined:
+		*m = 0
+	default:
+		return fmt.Errorf("cannot decode %s into Money", t)
+	}
+	return nil
+}
+
+// Allocate divides m proportionally to weights using the largest remainder
+// method. Every cent is assigned, so the parts always add up to exactly m.
+// Leftover cents go to the parts with the largest remainders, and ties are
+// broken by position so earlier parts receive the extra cent first.
+func (m Money) Allocate(weights []int64) ([]Money, error) {
+	if len(weights) == 0 {
+		return nil, errors.New("no weights to allocate between")
+	}
+
+	totalWeight := big.NewInt(0)
+	for _, w := range weights {
+		if w < 0 {
+			return nil, errors.New("weights cannot be negative")
+		}
+		totalWeight.Add(totalWeight, big.NewInt(w))
+	}
+	if totalWeight.Sign() == 0 {
+		return nil, errors.New("weights must add up to more than zero")
+	}
+
+	negative := m < 0
+	total := big.NewInt(int64(m.Abs()))
+
+	parts := make([]Money, len(weights))
+	remainders := make([]*big.Int, len(weights))
+	allocated := Money(0)
+	for i, w := range weights {
+		quotient, remainder := new(big.Int).QuoRem(
+			new(big.Int).Mul(total, big.NewInt(w)),
+			totalWeight,
+			new(big.Int),
+		)
+		parts[i] = Money(quotient.Int64())
+		remainders[i] = remainder
+		allocated += parts[i]
+	}
+
+	// Hand out the remaining cents one at a time
+	for leftover := m.Abs() - allocated; leftover > 0; leftover-- {
+		best := -1
+		for i := range parts {
+			if weights[i] == 0 {
+				continue
+			}
+			if best == -1 || remainders[i].Cmp(remainders[best]) > 0 {
+				best = i
+			}
+		}
+		parts[best]++
+		remainders[best] = big.NewInt(-1)
+	}
+
+	if negative {
+		for i := range parts {
+			parts[i] = -parts[i]
+		}
+	}
+	return parts, nil
+}
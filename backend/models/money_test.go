@@ -0,0 +1,147 @@
+package models
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		ok   bool
+	}{
+		{"12.34", 1234, true},
+		{"5", 500, true},
+		{"5.", 500, true},
+		{".5", 50, true},
+		{"0.07", 7, true},
+		{" 1.50 ", 150, true},
+		{"+3.10", 310, true},
+		{"-5", -500, true},
+		{"-0.01", -1, true},
+		{"92233720368547758.07", math.MaxInt64, true},
+		{"-92233720368547758.07", -math.MaxInt64, true},
+		{"92233720368547758.08", 0, false},
+		{"100000000000000000000", 0, false},
+		{"1.234", 0, false},
+		{"", 0, false},
+		{".", 0, false},
+		{"-", 0, false},
+		{"--1", 0, false},
+		{"1.-2", 0, false},
+		{"abc", 0, false},
+		{"1,50", 0, false},
+		{"1e2", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMoney(tt.in)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParseMoney(%q) error = %v, want ok = %v", tt.in, err, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   Money
+		weights []int64
+		want    []Money
+		ok      bool
+	}{
+		{"even", 900, []int64{1, 1, 1}, []Money{300, 300, 300}, true},
+		{"remainder to the first part", 10000, []int64{1, 1, 1}, []Money{3334, 3333, 3333}, true},
+		{"two remainder cents", 200, []int64{1, 1, 1}, []Money{67, 67, 66}, true},
+		{"largest remainder first", 10, []int64{1, 2}, []Money{3, 7}, true},
+		{"single cent", 1, []int64{1, 1}, []Money{1, 0}, true},
+		{"negative", -10000, []int64{1, 1, 1}, []Money{-3334, -3333, -3333}, true},
+		{"zero weight gets nothing", 101, []int64{0, 1, 1}, []Money{0, 51, 50}, true},
+		{"zero total", 0, []int64{1, 2}, []Money{0, 0}, true},
+		{"large total", math.MaxInt64, []int64{1, 1}, []Money{math.MaxInt64/2 + 1, math.MaxInt64 / 2}, true},
+		{"large weights", 100, []int64{math.MaxInt64, math.MaxInt64, 1}, []Money{50, 50, 0}, true},
+		{"no weights", 100, nil, nil, false},
+		{"negative weight", 100, []int64{1, -1}, nil, false},
+		{"zero weights", 100, []int64{0, 0}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.total.Allocate(tt.weights)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error = %v, want ok = %v", err, tt.ok)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			var sum Money
+			for _, part := range got {
+				sum += part
+			}
+			if tt.ok && sum != tt.total {
+				t.Errorf("parts add up to %d, want %d", sum, tt.total)
+			}
+		})
+	}
+}
+
+func TestMoneyUnmarshalBSONValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  Money
+		ok    bool
+	}{
+		{"int64 cents", int64(1234), 1234, true},
+		{"int32 cents", int32(-250), -250, true},
+		{"legacy double", 12.34, 1234, true},
+		{"legacy double with float error", 0.1 + 0.2, 30, true},
+		{"legacy negative double", -19.99, -1999, true},
+		{"null", nil, 0, true},
+		{"string", "12.34", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(bson.M{"amount": tt.value})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc struct {
+				Amount Money `bson:"amount"`
+			}
+			err = bson.Unmarshal(data, &doc)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error = %v, want ok = %v", err, tt.ok)
+			}
+			if doc.Amount != tt.want {
+				t.Errorf("got %d, want %d", doc.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyBSONRoundTrip(t *testing.T) {
+	data, err := bson.Marshal(bson.M{"amount": Money(-123456789)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bson.Raw(data).Lookup("amount").Type; got != bson.TypeInt64 {
+		t.Fatalf("stored as %s, want int64", got)
+	}
+	var doc struct {
+		Amount Money `bson:"amount"`
+	}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Amount != -123456789 {
+		t.Errorf("got %d, want -123456789", doc.Amount)
+	}
+}
@@ -7,16 +7,35 @@ import (
 )
 
 type Settlement struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	GroupID   primitive.ObjectID `bson:"groupId" json:"groupId"`
-	FromUser  primitive.ObjectID `bson:"fromUser" json:"fromUser"` // Debtor
-	ToUser    primitive.ObjectID `bson:"toUser" json:"toUser"`     // Creditor
-	Amount    float64            `bson:"amount" json:"amount"`
-	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	GroupID      primitive.ObjectID  `bson:"groupId" json:"groupId"`
+	FromUser     primitive.ObjectID  `bson:"fromUser" json:"fromUser"` // Debtor
+	ToUser       primitive.ObjectID  `bson:"toUser" json:"toUser"`     // Creditor
+	Amount       Money               `bson:"amount" json:"amount"`
+	Currency     string              `bson:"currency,omitempty" json:"currency"` // Always the group's base currency
+	Note         string              `bson:"note,omitempty" json:"note,omitempty"`
+	AllocationID *primitive.ObjectID `bson:"allocationId,omitempty" json:"allocationId,omitempty"` // Shared by the payments one cross-group transfer was split into
+	CreatedBy    primitive.ObjectID  `bson:"createdBy" json:"createdBy"`                           // Member who recorded the payment
+	CreatedAt    time.Time           `bson:"createdAt" json:"createdAt"`
 }
 
 type SettlementResponse struct {
-	FromUser string  `json:"fromUser"`
-	ToUser   string  `json:"toUser"`
-	Amount   float64 `json:"amount"`
+	FromUser string `json:"fromUser"`
+	ToUser   string `json:"toUser"`
+	Amount   Money  `json:"amount"`
+}
+
+type RecordSettlementRequest struct {
+	GroupID  string `json:"groupId" binding:"required"`
+	FromUser string `json:"fromUser" binding:"required"`
+	ToUser   string `json:"toUser" binding:"required"`
+	Amount   Money  `json:"amount" binding:"required,gt=0"`
+	Note     string `json:"note"`
+}
+
+type CrossGroupPaymentRequest struct {
+	ToUser   string `json:"toUser" binding:"required"`
+	Amount   Money  `json:"amount" binding:"omitempty,gt=0"` // Defaults to everything owed
+	Currency string `json:"currency"`                        // Needed when groups in several currencies are shared
+	Note     string `json:"note"`
 }
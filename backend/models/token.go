@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken is a server-side record of an issued refresh token. Tokens are
+// rotated on every use; all tokens descending from one login share a FamilyID
+// so the whole chain can be revoked when a used token is presented again.
+type RefreshToken struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID  `bson:"userId" json:"userId"`
+	FamilyID   primitive.ObjectID  `bson:"familyId" json:"familyId"`
+	TokenHash  string              `bson:"tokenHash" json:"-"`
+	ExpiresAt  time.Time           `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+	RevokedAt  *time.Time          `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	ReplacedBy *primitive.ObjectID `bson:"replacedBy,omitempty" json:"replacedBy,omitempty"`
+}
+
+// RevokedToken denylists an access token (by jti) until it would have expired
+type RevokedToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TokenID   string             `bson:"jti" json:"jti"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt time.Time          `bson:"revokedAt" json:"revokedAt"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
@@ -9,7 +9,7 @@ import (
 type User struct {
 	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
 	Name      string               `bson:"name" json:"name" validate:"required"`
-	Email     string               `bson:"email" json:"email" validate:"required,email"`
+	Email     string               `bson:"email" json:"email" validate:"required,email"` // Lower-cased
 	Password  string               `bson:"password" json:"password" validate:"required"`
 	Groups    []primitive.ObjectID `bson:"groups" json:"groups"`
 	CreatedAt time.Time            `bson:"createdAt" json:"createdAt"`
@@ -0,0 +1,923 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"expensetracker/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryData holds every collection of the in-memory store. Stored values are
+// never modified in place, so copying the maps is enough to snapshot it.
+type memoryData struct {
+	users         map[primitive.ObjectID]models.User
+	groups        map[primitive.ObjectID]models.Group
+	expenses      map[primitive.ObjectID]models.Expense
+	revisions     map[primitive.ObjectID]models.ExpenseRevision
+	splits        map[primitive.ObjectID]models.Split
+	settlements   map[primitive.ObjectID]models.Settlement
+	fxRates       map[primitive.ObjectID]models.FXRate
+	refreshTokens map[primitive.ObjectID]models.RefreshToken
+	revokedTokens map[primitive.ObjectID]models.RevokedToken
+	invitations   map[primitive.ObjectID]models.Invitation
+	balances      map[primitive.ObjectID]models.GroupBalance
+}
+
+func (d *memoryData) snapshot() *memoryData {
+	return &memoryData{
+		users:         maps.Clone(d.users),
+		groups:        maps.Clone(d.groups),
+		expenses:      maps.Clone(d.expenses),
+		revisions:     maps.Clone(d.revisions),
+		splits:        maps.Clone(d.splits),
+		settlements:   maps.Clone(d.settlements),
+		fxRates:       maps.Clone(d.fxRates),
+		refreshTokens: maps.Clone(d.refreshTokens),
+		revokedTokens: maps.Clone(d.revokedTokens),
+		invitations:   maps.Clone(d.invitations),
+		balances:      maps.Clone(d.balances),
+	}
+}
+
+type memoryDB struct {
+	mu   sync.RWMutex
+	txMu sync.Mutex // Serializes transactions
+	data *memoryData
+}
+
+// NewMemoryStore returns a Store that keeps everything in process memory.
+// It is meant for local development and tests; data is lost on restart.
+func NewMemoryStore() *Store {
+	db := &memoryDB{data: &memoryData{
+		users:         map[primitive.ObjectID]models.User{},
+		groups:        map[primitive.ObjectID]models.Group{},
+		expenses:      map[primitive.ObjectID]models.Expense{},
+		revisions:     map[primitive.ObjectID]models.ExpenseRevision{},
+		splits:        map[primitive.ObjectID]models.Split{},
+		settlements:   map[primitive.ObjectID]models.Settlement{},
+		fxRates:       map[primitive.ObjectID]models.FXRate{},
+		refreshTokens: map[primitive.ObjectID]models.RefreshToken{},
+		revokedTokens: map[primitive.ObjectID]models.RevokedToken{},
+		invitations:   map[primitive.ObjectID]models.Invitation{},
+		balances:      map[primitive.ObjectID]models.GroupBalance{},
+	}}
+
+	return &Store{
+		Users:       &memoryUserRepository{db: db},
+		Groups:      &memoryGroupRepository{db: db},
+		Expenses:    &memoryExpenseRepository{db: db},
+		Splits:      &memorySplitRepository{db: db},
+		Settlements: &memorySettlementRepository{db: db},
+		FXRates:     &memoryFXRateRepository{db: db},
+		Balances:    &memoryBalanceRepository{db: db},
+		Invitations: &memoryInvitationRepository{db: db},
+		Tokens:      &memoryTokenRepository{db: db},
+
+		withTransaction: db.withTransaction,
+	}
+}
+
+// withTransaction restores the data as it was before fn if fn fails. Writes
+// made outside a transaction while one is running are rolled back with it,
+// which is acceptable for a development store.
+func (db *memoryDB) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	db.mu.RLock()
+	before := db.data.snapshot()
+	db.mu.RUnlock()
+
+	if err := fn(ctx); err != nil {
+		db.mu.Lock()
+		db.data = before
+		db.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// copyOf deep copies a document by round-tripping it through BSON, so the
+// in-memory store hands out the same shapes MongoDB would
+func copyOf[T any](doc T) T {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		panic("repository: cannot copy document: " + err.Error())
+	}
+	var out T
+	if err := bson.Unmarshal(data, &out); err != nil {
+		panic("repository: cannot copy document: " + err.Error())
+	}
+	return out
+}
+
+// findByID returns a copy of the document stored under id
+func findByID[T any](docs map[primitive.ObjectID]T, id primitive.ObjectID) (*T, error) {
+	doc, ok := docs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := copyOf(doc)
+	return &found, nil
+}
+
+// findFirst returns a copy of the first document (in insertion order) matching keep
+func findFirst[T any](docs map[primitive.ObjectID]T, keep func(T) bool) (*T, error) {
+	for _, id := range sortedIDs(docs) {
+		if keep(docs[id]) {
+			found := copyOf(docs[id])
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// filterDocs returns copies of the documents matching keep in insertion order
+func filterDocs[T any](docs map[primitive.ObjectID]T, keep func(T) bool) []T {
+	found := []T{}
+	for _, id := range sortedIDs(docs) {
+		if keep == nil || keep(docs[id]) {
+			found = append(found, copyOf(docs[id]))
+		}
+	}
+	return found
+}
+
+// sortedIDs orders document IDs by insertion. ObjectIDs start with their
+// creation time and a counter, so ordering by ID matches insertion order.
+func sortedIDs[T any](docs map[primitive.ObjectID]T) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(docs))
+	for id := range docs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 })
+	return ids
+}
+
+type memoryUserRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.data.users[user.ID] = copyOf(*user)
+	return nil
+}
+
+func (r *memoryUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return findByID(r.db.data.users, id)
+}
+
+func (r *memoryUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return findFirst(r.db.data.users, func(u models.User) bool { return u.Email == email })
+}
+
+func (r *memoryUserRepository) AddGroup(ctx context.Context, userID, groupID primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	user, ok := r.db.data.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user = copyOf(user)
+	user.Groups = append(user.Groups, groupID)
+	r.db.data.users[userID] = user
+	return nil
+}
+
+func (r *memoryUserRepository) RemoveGroup(ctx context.Context, userID, groupID primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	user, ok := r.db.data.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user = copyOf(user)
+	user.Groups = slices.DeleteFunc(user.Groups, func(id primitive.ObjectID) bool { return id == groupID })
+	r.db.data.users[userID] = user
+	return nil
+}
+
+type memoryGroupRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryGroupRepository) Create(ctx context.Context, group *models.Group) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.data.groups[group.ID] = copyOf(*group)
+	return nil
+}
+
+func (r *memoryGroupRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Group, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return findByID(r.db.data.groups, id)
+}
+
+func (r *memoryGroupRepository) FindByMember(ctx context.Context, userID primitive.ObjectID) ([]models.Group, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return filterDocs(r.db.data.groups, func(g models.Group) bool {
+		for _, memberID := range g.Members {
+			if memberID == userID {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (r *memoryGroupRepository) AddMember(ctx context.Context, groupID, userID primitive.ObjectID, role string) error {
+	return r.update(groupID, func(group *models.Group) {
+		group.Members = append(group.Members, userID)
+		group.FormerMembers = slices.DeleteFunc(group.FormerMembers, func(id primitive.ObjectID) bool { return id == userID })
+		if group.Roles == nil {
+			group.Roles = map[string]string{}
+		}
+		group.Roles[userID.Hex()] = role
+	})
+}
+
+func (r *memoryGroupRepository) RemoveMember(ctx context.Context, groupID, userID primitive.ObjectID) error {
+	return r.update(groupID, func(group *models.Group) {
+		group.Members = slices.DeleteFunc(group.Members, func(id primitive.ObjectID) bool { return id == userID })
+		if !slices.Contains(group.FormerMembers, userID) {
+			group.FormerMembers = append(group.FormerMembers, userID)
+		}
+		delete(group.Roles, userID.Hex())
+	})
+}
+
+func (r *memoryGroupRepository) Rename(ctx context.Context, groupID primitive.ObjectID, name string) error {
+	return r.update(groupID, func(group *models.Group) {
+		group.Name = name
+	})
+}
+
+func (r *memoryGroupRepository) AddCategory(ctx context.Context, groupID primitive.ObjectID, category string) error {
+	return r.update(groupID, func(group *models.Group) {
+		if !slices.Contains(group.CustomCategories, category) {
+			group.CustomCategories = append(group.CustomCategories, category)
+		}
+	})
+}
+
+func (r *memoryGroupRepository) RemoveCategory(ctx context.Context, groupID primitive.ObjectID, category string) error {
+	return r.update(groupID, func(group *models.Group) {
+		group.CustomCategories = slices.DeleteFunc(group.CustomCategories, func(c string) bool { return c == category })
+	})
+}
+
+func (r *memoryGroupRepository) SetSettlementRules(ctx context.Context, groupID primitive.ObjectID, rules *models.SettlementRules) error {
+	return r.update(groupID, func(group *models.Group) {
+		group.SettlementRules = rules
+	})
+}
+
+func (r *memoryGroupRepository) AddGuest(ctx context.Context, groupID primitive.ObjectID, guest models.GuestMember) error {
+	return r.update(groupID, func(group *models.Group) {
+		group.Guests = append(group.Guests, guest)
+	})
+}
+
+func (r *memoryGroupRepository) RemoveGuest(ctx context.Context, groupID, guestID primitive.ObjectID) error {
+	return r.update(groupID, func(group *models.Group) {
+		group.Guests = slices.DeleteFunc(group.Guests, func(g models.GuestMember) bool { return g.ID == guestID })
+	})
+}
+
+func (r *memoryGroupRepository) SetRoles(ctx context.Context, groupID primitive.ObjectID, roles map[primitive.ObjectID]string) error {
+	return r.update(groupID, func(group *models.Group) {
+		if group.Roles == nil {
+			group.Roles = map[string]string{}
+		}
+		for userID, role := range roles {
+			group.Roles[userID.Hex()] = role
+		}
+	})
+}
+
+// update applies fn to a copy of the group and stores the result
+func (r *memoryGroupRepository) update(groupID primitive.ObjectID, fn func(group *models.Group)) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	group, ok := r.db.data.groups[groupID]
+	if !ok {
+		return ErrNotFound
+	}
+	group = copyOf(group)
+	fn(&group)
+	r.db.data.groups[groupID] = group
+	return nil
+}
+
+type memoryExpenseRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryExpenseRepository) Create(ctx context.Context, expense *models.Expense) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.data.expenses[expense.ID] = copyOf(*expense)
+	return nil
+}
+
+func (r *memoryExpenseRepository) CreateMany(ctx context.Context, expenses []models.Expense) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, expense := range expenses {
+		r.db.data.expenses[expense.ID] = copyOf(expense)
+	}
+	return nil
+}
+
+func (r *memoryExpenseRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Expense, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return findByID(r.db.data.expenses, id)
+}
+
+func (r *memoryExpenseRepository) FindByGroup(ctx context.Context, groupID primitive.ObjectID) ([]models.Expense, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return filterDocs(r.db.data.expenses, func(e models.Expense) bool { return e.GroupID == groupID }), nil
+}
+
+func (r *memoryExpenseRepository) BalanceTotals(ctx context.Context, groupID primitive.ObjectID) ([]models.UserTotals, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	totals := map[primitive.ObjectID]*models.UserTotals{}
+	total := func(userID primitive.ObjectID) *models.UserTotals {
+		if totals[userID] == nil {
+			totals[userID] = &models.UserTotals{UserID: userID}
+		}
+		return totals[userID]
+	}
+
+	expenses := map[primitive.ObjectID]models.Expense{}
+	for id, expense := range r.db.data.expenses {
+		if expense.GroupID != groupID {
+			continue
+		}
+		expenses[id] = expense
+		for _, payer := range expense.BasePaid() {
+			total(payer.UserID).Paid += payer.BaseAmount
+		}
+	}
+	for _, split := range r.db.data.splits {
+		if expense, ok := expenses[split.ExpenseID]; ok {
+			total(split.UserID).Owed += expense.BaseOwed(split)
+		}
+	}
+
+	result := make([]models.UserTotals, 0, len(totals))
+	for _, id := range sortedIDs(totals) {
+		result = append(result, *totals[id])
+	}
+	return result, nil
+}
+
+func (r *memoryExpenseRepository) Search(ctx context.Context, query models.ExpenseQuery) ([]models.Expense, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	// Orders a before b in the requested direction, ties broken by ID
+	before := func(a, b *models.Expense) bool {
+		av, bv := a.SortValue(query.SortBy), b.SortValue(query.SortBy)
+		cmp := bytes.Compare(a.ID[:], b.ID[:])
+		if av != bv {
+			cmp = -1
+			if av > bv {
+				cmp = 1
+			}
+		}
+		if query.Ascending {
+			return cmp < 0
+		}
+		return cmp > 0
+	}
+
+	expenses := filterDocs(r.db.data.expenses, func(e models.Expense) bool {
+		if !matchesExpenseQuery(&e, query) {
+			return false
+		}
+		if query.After != nil {
+			// Only expenses ordered after the cursor
+			if sortValue := e.SortValue(query.SortBy); sortValue != query.After.Value {
+				return query.Ascending == (sortValue > query.After.Value)
+			}
+			cmp := bytes.Compare(e.ID[:], query.After.ID[:])
+			return cmp != 0 && query.Ascending == (cmp > 0)
+		}
+		return true
+	})
+
+	sort.Slice(expenses, func(i, j int) bool { return before(&expenses[i], &expenses[j]) })
+	if len(expenses) > query.Limit {
+		expenses = expenses[:query.Limit]
+	}
+	return expenses, nil
+}
+
+func (r *memoryExpenseRepository) Totals(ctx context.Context, query models.ExpenseQuery, groupBy string) ([]models.ExpenseTotal, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	byKey := map[string]*models.ExpenseTotal{}
+	add := func(key string, amount models.Money) {
+		if byKey[key] == nil {
+			byKey[key] = &models.ExpenseTotal{Key: key}
+		}
+		byKey[key].Total += amount
+		byKey[key].Count++
+	}
+	for _, e := range r.db.data.expenses {
+		if !matchesExpenseQuery(&e, query) {
+			continue
+		}
+		if groupBy == models.ExpenseGroupTag {
+			for _, tag := range e.Tags {
+				add(tag, e.BaseTotal())
+			}
+		} else {
+			add(e.Category, e.BaseTotal())
+		}
+	}
+
+	totals := []models.ExpenseTotal{}
+	for _, total := range byKey {
+		totals = append(totals, *total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Total != totals[j].Total {
+			return totals[i].Total > totals[j].Total
+		}
+		return totals[i].Key < totals[j].Key
+	})
+	return totals, nil
+}
+
+func (r *memoryExpenseRepository) Report(ctx context.Context, query models.ExpenseQuery) (*models.ExpenseReport, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	byCategory, byPayer, byMember, byMonth := map[string]*models.ExpenseTotal{}, map[string]*models.ExpenseTotal{}, map[string]*models.ExpenseTotal{}, map[string]*models.ExpenseTotal{}
+	add := func(totals map[string]*models.ExpenseTotal, key string, amount models.Money) {
+		if totals[key] == nil {
+			totals[key] = &models.ExpenseTotal{Key: key}
+		}
+		totals[key].Total += amount
+		totals[key].Count++
+	}
+
+	splitsByExpense := map[primitive.ObjectID][]models.Split{}
+	for _, split := range r.db.data.splits {
+		splitsByExpense[split.ExpenseID] = append(splitsByExpense[split.ExpenseID], split)
+	}
+
+	report := &models.ExpenseReport{}
+	for _, e := range r.db.data.expenses {
+		if !matchesExpenseQuery(&e, query) {
+			continue
+		}
+		report.Total += e.BaseTotal()
+		report.Count++
+		add(byCategory, e.Category, e.BaseTotal())
+		add(byMonth, e.ExpenseDate().UTC().Format("2006-01"), e.BaseTotal())
+		for _, payer := range e.BasePaid() {
+			add(byPayer, payer.UserID.Hex(), payer.BaseAmount)
+		}
+		for _, split := range splitsByExpense[e.ID] {
+			add(byMember, split.UserID.Hex(), e.BaseOwed(split))
+		}
+	}
+
+	sorted := func(totals map[string]*models.ExpenseTotal, byKey bool) []models.ExpenseTotal {
+		list := []models.ExpenseTotal{}
+		for _, total := range totals {
+			list = append(list, *total)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if !byKey && list[i].Total != list[j].Total {
+				return list[i].Total > list[j].Total
+			}
+			return list[i].Key < list[j].Key
+		})
+		return list
+	}
+	report.ByCategory = sorted(byCategory, false)
+	report.ByPayer = sorted(byPayer, false)
+	report.ByMember = sorted(byMember, false)
+	report.ByMonth = sorted(byMonth, true)
+	return report, nil
+}
+
+func (r *memoryExpenseRepository) Each(ctx context.Context, query models.ExpenseQuery, fn func(expense models.Expense, splits []models.Split) error) error {
+	// Copy everything first: fn may read the store itself
+	r.db.mu.RLock()
+	expenses := filterDocs(r.db.data.expenses, func(e models.Expense) bool { return matchesExpenseQuery(&e, query) })
+	splitsByExpense := map[primitive.ObjectID][]models.Split{}
+	for _, split := range filterDocs(r.db.data.splits, nil) {
+		splitsByExpense[split.ExpenseID] = append(splitsByExpense[split.ExpenseID], split)
+	}
+	r.db.mu.RUnlock()
+
+	sort.Slice(expenses, func(i, j int) bool {
+		a, b := expenses[i].ExpenseDate(), expenses[j].ExpenseDate()
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return bytes.Compare(expenses[i].ID[:], expenses[j].ID[:]) < 0
+	})
+	for _, expense := range expenses {
+		if err := fn(expense, splitsByExpense[expense.ID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchesExpenseQuery reports whether e passes query's filters, ignoring its
+// cursor
+func matchesExpenseQuery(e *models.Expense, query models.ExpenseQuery) bool {
+	if e.GroupID != query.GroupID {
+		return false
+	}
+	if query.PaidBy != nil && !e.IsPayer(*query.PaidBy) {
+		return false
+	}
+	if query.Category != "" && e.Category != query.Category {
+		return false
+	}
+	if query.Tag != "" && !slices.Contains(e.Tags, query.Tag) {
+		return false
+	}
+	if query.Text != "" && !strings.Contains(strings.ToLower(e.Description), strings.ToLower(query.Text)) {
+		return false
+	}
+	date := e.ExpenseDate()
+	if (query.DateFrom != nil && date.Before(*query.DateFrom)) || (query.DateBefore != nil && !date.Before(*query.DateBefore)) {
+		return false
+	}
+	amount := e.BaseTotal()
+	return (query.MinAmount == nil || amount >= *query.MinAmount) && (query.MaxAmount == nil || amount <= *query.MaxAmount)
+}
+
+func (r *memoryExpenseRepository) Replace(ctx context.Context, expense *models.Expense) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if _, ok := r.db.data.expenses[expense.ID]; !ok {
+		return ErrNotFound
+	}
+	r.db.data.expenses[expense.ID] = copyOf(*expense)
+	return nil
+}
+
+func (r *memoryExpenseRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	if _, ok := r.db.data.expenses[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.db.data.expenses, id)
+	return nil
+}
+
+func (r *memoryExpenseRepository) SaveRevision(ctx context.Context, revision *models.ExpenseRevision) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.data.revisions[revision.ID] = copyOf(*revision)
+	return nil
+}
+
+func (r *memoryExpenseRepository) FindRevisions(ctx context.Context, groupID primitive.ObjectID, expenseID *primitive.ObjectID) ([]models.ExpenseRevision, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	revisions := filterDocs(r.db.data.revisions, func(rev models.ExpenseRevision) bool {
+		return rev.GroupID == groupID && (expenseID == nil || rev.ExpenseID == *expenseID)
+	})
+	sort.SliceStable(revisions, func(i, j int) bool { return revisions[i].ChangedAt.After(revisions[j].ChangedAt) })
+	return revisions, nil
+}
+
+func (r *memoryExpenseRepository) ReassignUser(ctx context.Context, groupID, from, to primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for id, expense := range r.db.data.expenses {
+		if expense.GroupID != groupID || !expense.IsPayer(from) {
+			continue
+		}
+		expense = copyOf(expense)
+		expense.ReassignPayer(from, to)
+		r.db.data.expenses[id] = expense
+	}
+	return nil
+}
+
+type memorySplitRepository struct {
+	db *memoryDB
+}
+
+func (r *memorySplitRepository) CreateMany(ctx context.Context, splits []models.Split) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, split := range splits {
+		r.db.data.splits[split.ID] = copyOf(split)
+	}
+	return nil
+}
+
+func (r *memorySplitRepository) FindByExpense(ctx context.Context, expenseID primitive.ObjectID) ([]models.Split, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return filterDocs(r.db.data.splits, func(s models.Split) bool { return s.ExpenseID == expenseID }), nil
+}
+
+func (r *memorySplitRepository) DeleteByExpense(ctx context.Context, expenseID primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for id, split := range r.db.data.splits {
+		if split.ExpenseID == expenseID {
+			delete(r.db.data.splits, id)
+		}
+	}
+	return nil
+}
+
+func (r *memorySplitRepository) ReassignUser(ctx context.Context, expenseIDs []primitive.ObjectID, from, to primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	// A share of to in the same expense absorbs from's
+	shares := make(map[primitive.ObjectID]primitive.ObjectID)
+	for id, split := range r.db.data.splits {
+		if split.UserID == to && slices.Contains(expenseIDs, split.ExpenseID) {
+			shares[split.ExpenseID] = id
+		}
+	}
+	for id, split := range r.db.data.splits {
+		if split.UserID != from || !slices.Contains(expenseIDs, split.ExpenseID) {
+			continue
+		}
+		if shareID, ok := shares[split.ExpenseID]; ok {
+			share := r.db.data.splits[shareID]
+			share.Amount += split.Amount
+			share.BaseAmount += split.BaseAmount
+			r.db.data.splits[shareID] = share
+			delete(r.db.data.splits, id)
+			continue
+		}
+		split.UserID = to
+		r.db.data.splits[id] = split
+	}
+	return nil
+}
+
+type memorySettlementRepository struct {
+	db *memoryDB
+}
+
+func (r *memorySettlementRepository) Create(ctx context.Context, settlement *models.Settlement) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.data.settlements[settlement.ID] = copyOf(*settlement)
+	return nil
+}
+
+func (r *memorySettlementRepository) FindByGroup(ctx context.Context, groupID primitive.ObjectID) ([]models.Settlement, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	settlements := filterDocs(r.db.data.settlements, func(s models.Settlement) bool { return s.GroupID == groupID })
+	sort.SliceStable(settlements, func(i, j int) bool { return settlements[i].CreatedAt.After(settlements[j].CreatedAt) })
+	return settlements, nil
+}
+
+func (r *memorySettlementRepository) ReassignUser(ctx context.Context, groupID, from, to primitive.ObjectID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for id, settlement := range r.db.data.settlements {
+		if settlement.GroupID != groupID || (settlement.FromUser != from && settlement.ToUser != from) {
+			continue
+		}
+		if settlement.FromUser == to || settlement.ToUser == to {
+			delete(r.db.data.settlements, id)
+			continue
+		}
+		if settlement.FromUser == from {
+			settlement.FromUser = to
+		}
+		if settlement.ToUser == from {
+			settlement.ToUser = to
+		}
+		r.db.data.settlements[id] = settlement
+	}
+	return nil
+}
+
+type memoryFXRateRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryFXRateRepository) Upsert(ctx context.Context, rates []models.FXRate) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for _, rate := range rates {
+		id := primitive.NewObjectID()
+		for existingID, existing := range r.db.data.fxRates {
+			if existing.Base == rate.Base && existing.Quote == rate.Quote && existing.Date.Equal(rate.Date) {
+				id = existingID
+				break
+			}
+		}
+		rate.ID = id
+		r.db.data.fxRates[id] = copyOf(rate)
+	}
+	return nil
+}
+
+func (r *memoryFXRateRepository) FindLatest(ctx context.Context, base, quote string, at time.Time) (*models.FXRate, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	var latest *models.FXRate
+	for _, rate := range r.db.data.fxRates {
+		if rate.Base != base || rate.Quote != quote || rate.Date.After(at) {
+			continue
+		}
+		if latest == nil || rate.Date.After(latest.Date) {
+			found := copyOf(rate)
+			latest = &found
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (r *memoryFXRateRepository) List(ctx context.Context, base, quote string) ([]models.FXRate, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	rates := filterDocs(r.db.data.fxRates, func(rate models.FXRate) bool {
+		return (base == "" || rate.Base == base) && (quote == "" || rate.Quote == quote)
+	})
+	sort.SliceStable(rates, func(i, j int) bool {
+		if !rates[i].Date.Equal(rates[j].Date) {
+			return rates[i].Date.After(rates[j].Date)
+		}
+		if rates[i].Base != rates[j].Base {
+			return rates[i].Base < rates[j].Base
+		}
+		return rates[i].Quote < rates[j].Quote
+	})
+	return rates, nil
+}
+
+type memoryTokenRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.data.refreshTokens[token.ID] = copyOf(*token)
+	return nil
+}
+
+func (r *memoryTokenRepository) FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return findFirst(r.db.data.refreshTokens, func(t models.RefreshToken) bool { return t.TokenHash == tokenHash })
+}
+
+func (r *memoryTokenRepository) RevokeRefreshToken(ctx context.Context, id primitive.ObjectID, replacedBy *primitive.ObjectID, at time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	token, ok := r.db.data.refreshTokens[id]
+	if !ok || token.RevokedAt != nil {
+		return ErrNotFound
+	}
+	token = copyOf(token)
+	token.RevokedAt = &at
+	token.ReplacedBy = replacedBy
+	r.db.data.refreshTokens[id] = token
+	return nil
+}
+
+func (r *memoryTokenRepository) RevokeRefreshFamily(ctx context.Context, familyID primitive.ObjectID, at time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	for id, token := range r.db.data.refreshTokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token = copyOf(token)
+			token.RevokedAt = &at
+			r.db.data.refreshTokens[id] = token
+		}
+	}
+	return nil
+}
+
+func (r *memoryTokenRepository) RevokeAccessToken(ctx context.Context, token *models.RevokedToken) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.data.revokedTokens[token.ID] = copyOf(*token)
+	return nil
+}
+
+func (r *memoryTokenRepository) IsAccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	_, err := findFirst(r.db.data.revokedTokens, func(t models.RevokedToken) bool { return t.TokenID == tokenID })
+	return err == nil, nil
+}
+
+type memoryInvitationRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryInvitationRepository) Create(ctx context.Context, invitation *models.Invitation) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.data.invitations[invitation.ID] = copyOf(*invitation)
+	return nil
+}
+
+func (r *memoryInvitationRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Invitation, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return findByID(r.db.data.invitations, id)
+}
+
+func (r *memoryInvitationRepository) FindPendingByEmail(ctx context.Context, email string, now time.Time) ([]models.Invitation, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return filterDocs(r.db.data.invitations, func(inv models.Invitation) bool {
+		return inv.Email == email && inv.AcceptedAt == nil && inv.ExpiresAt.After(now)
+	}), nil
+}
+
+func (r *memoryInvitationRepository) MarkAccepted(ctx context.Context, id, userID primitive.ObjectID, at time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	invitation, ok := r.db.data.invitations[id]
+	if !ok || invitation.AcceptedAt != nil {
+		return ErrNotFound
+	}
+	invitation = copyOf(invitation)
+	invitation.AcceptedAt = &at
+	invitation.AcceptedBy = &userID
+	r.db.data.invitations[id] = invitation
+	return nil
+}
+
+type memoryBalanceRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryBalanceRepository) FindByGroup(ctx context.Context, groupID primitive.ObjectID) (*models.GroupBalance, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return findByID(r.db.data.balances, groupID)
+}
+
+func (r *memoryBalanceRepository) Apply(ctx context.Context, groupID primitive.ObjectID, deltas map[string]models.Money) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	balance, ok := r.db.data.balances[groupID]
+	if !ok {
+		return ErrNotFound
+	}
+	balance = copyOf(balance)
+	if balance.Balances == nil {
+		balance.Balances = map[string]models.Money{}
+	}
+	for userID, delta := range deltas {
+		if delta != 0 {
+			balance.Balances[userID] += delta
+		}
+	}
+	balance.UpdatedAt = time.Now()
+	r.db.data.balances[groupID] = balance
+	return nil
+}
+
+func (r *memoryBalanceRepository) Replace(ctx context.Context, balance *models.GroupBalance) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	r.db.data.balances[balance.GroupID] = copyOf(*balance)
+	return nil
+}
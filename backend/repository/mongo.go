@@ -0,0 +1,940 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"time"
+
+	"expensetracker/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver"
+)
+
+// NewMongoStore returns a Store backed by the expensetracker database
+func NewMongoStore(client *mongo.Client) *Store {
+	return NewMongoDatabaseStore(client.Database("expensetracker"))
+}
+
+// NewMongoDatabaseStore returns a Store backed by the given database
+func NewMongoDatabaseStore(db *mongo.Database) *Store {
+	client := db.Client()
+	return &Store{
+		Users:       &mongoUserRepository{users: db.Collection("users")},
+		Groups:      &mongoGroupRepository{groups: db.Collection("groups")},
+		Expenses:    &mongoExpenseRepository{expenses: db.Collection("expenses"), history: db.Collection("expense_history")},
+		Splits:      &mongoSplitRepository{splits: db.Collection("splits")},
+		Settlements: &mongoSettlementRepository{settlements: db.Collection("settlements")},
+		FXRates:     &mongoFXRateRepository{rates: db.Collection("fx_rates")},
+		Balances:    &mongoBalanceRepository{balances: db.Collection("group_balances")},
+		Invitations: &mongoInvitationRepository{invitations: db.Collection("invitations")},
+		Tokens:      &mongoTokenRepository{refreshTokens: db.Collection("refresh_tokens"), revokedTokens: db.Collection("revoked_tokens")},
+
+		withTransaction: func(ctx context.Context, fn func(ctx context.Context) error) error {
+			return withMongoTransaction(ctx, client, fn)
+		},
+	}
+}
+
+// EnsureMongoIndexes creates the indexes the repositories rely on: splits
+// are looked up by expense, expenses and payments by group, refresh tokens by
+// hash and revoked access tokens by jti. Tokens are removed once they have
+// expired. Creating an index that already exists is a no-op.
+func EnsureMongoIndexes(ctx context.Context, client *mongo.Client) error {
+	return EnsureMongoDatabaseIndexes(ctx, client.Database("expensetracker"))
+}
+
+// EnsureMongoDatabaseIndexes creates the indexes of EnsureMongoIndexes in the
+// given database
+func EnsureMongoDatabaseIndexes(ctx context.Context, db *mongo.Database) error {
+	expiresAtTTL := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	indexes := map[string][]mongo.IndexModel{
+		"splits":      {{Keys: bson.D{{Key: "expenseId", Value: 1}}}},
+		"expenses":    {{Keys: bson.D{{Key: "groupId", Value: 1}, {Key: "date", Value: -1}}}},
+		"settlements": {{Keys: bson.D{{Key: "groupId", Value: 1}, {Key: "createdAt", Value: -1}}}},
+		"refresh_tokens": {
+			{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			expiresAtTTL,
+		},
+		"revoked_tokens": {
+			{Keys: bson.D{{Key: "jti", Value: 1}}, Options: options.Index().SetUnique(true)},
+			expiresAtTTL,
+		},
+	}
+	for collection, indexModels := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, indexModels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transactionAttempts bounds how often a transaction aborted by a transient
+// error (failover, write conflict, network blip) is run again
+const transactionAttempts = 3
+
+// withMongoTransaction runs fn in a multi-document transaction, starting over
+// with a fresh session when it fails with a transient error
+func withMongoTransaction(ctx context.Context, client *mongo.Client, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := runMongoTransaction(ctx, client, fn)
+		if err == nil || attempt == transactionAttempts || !isTransientError(err) || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("Retrying transaction after transient error (attempt %d): %v", attempt, err)
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+}
+
+func runMongoTransaction(ctx context.Context, client *mongo.Client, fn func(ctx context.Context) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+func isTransientError(err error) bool {
+	var labeled mongo.LabeledError
+	if errors.As(err, &labeled) {
+		if labeled.HasErrorLabel(driver.TransientTransactionError) || labeled.HasErrorLabel(driver.UnknownTransactionCommitResult) {
+			return true
+		}
+	}
+	return mongo.IsNetworkError(err)
+}
+
+// findOne decodes a single document, mapping a missing document to ErrNotFound
+func findOne[T any](ctx context.Context, collection *mongo.Collection, filter interface{}) (*T, error) {
+	var doc T
+	err := collection.FindOne(ctx, filter).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// findAll decodes every matching document and never returns a nil slice
+func findAll[T any](ctx context.Context, collection *mongo.Collection, filter interface{}, opts ...*options.FindOptions) ([]T, error) {
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	docs := []T{}
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// checkMatched turns an update that matched nothing into ErrNotFound
+func checkMatched(result *mongo.UpdateResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoUserRepository struct {
+	users *mongo.Collection
+}
+
+func (r *mongoUserRepository) Create(ctx context.Context, user *models.User) error {
+	_, err := r.users.InsertOne(ctx, user)
+	return err
+}
+
+func (r *mongoUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return findOne[models.User](ctx, r.users, bson.M{"_id": id})
+}
+
+func (r *mongoUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return findOne[models.User](ctx, r.users, bson.M{"email": email})
+}
+
+func (r *mongoUserRepository) AddGroup(ctx context.Context, userID, groupID primitive.ObjectID) error {
+	return checkMatched(r.users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$push": bson.M{"groups": groupID}},
+	))
+}
+
+func (r *mongoUserRepository) RemoveGroup(ctx context.Context, userID, groupID primitive.ObjectID) error {
+	return checkMatched(r.users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$pull": bson.M{"groups": groupID}},
+	))
+}
+
+type mongoGroupRepository struct {
+	groups *mongo.Collection
+}
+
+func (r *mongoGroupRepository) Create(ctx context.Context, group *models.Group) error {
+	_, err := r.groups.InsertOne(ctx, group)
+	return err
+}
+
+func (r *mongoGroupRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Group, error) {
+	return findOne[models.Group](ctx, r.groups, bson.M{"_id": id})
+}
+
+func (r *mongoGroupRepository) FindByMember(ctx context.Context, userID primitive.ObjectID) ([]models.Group, error) {
+	return findAll[models.Group](ctx, r.groups, bson.M{"members": userID})
+}
+
+func (r *mongoGroupRepository) AddMember(ctx context.Context, groupID, userID primitive.ObjectID, role string) error {
+	return checkMatched(r.groups.UpdateOne(ctx,
+		bson.M{"_id": groupID},
+		bson.M{
+			"$push": bson.M{"members": userID},
+			"$pull": bson.M{"formerMembers": userID},
+			"$set":  bson.M{"roles." + userID.Hex(): role},
+		},
+	))
+}
+
+func (r *mongoGroupRepository) RemoveMember(ctx context.Context, groupID, userID primitive.ObjectID) error {
+	return checkMatched(r.groups.UpdateOne(ctx,
+		bson.M{"_id": groupID},
+		bson.M{
+			"$pull":     bson.M{"members": userID},
+			"$addToSet": bson.M{"formerMembers": userID},
+			"$unset":    bson.M{"roles." + userID.Hex(): ""},
+		},
+	))
+}
+
+func (r *mongoGroupRepository) Rename(ctx context.Context, groupID primitive.ObjectID, name string) error {
+	return checkMatched(r.groups.UpdateOne(ctx,
+		bson.M{"_id": groupID},
+		bson.M{"$set": bson.M{"name": name}},
+	))
+}
+
+func (r *mongoGroupRepository) AddCategory(ctx context.Context, groupID primitive.ObjectID, category string) error {
+	return checkMatched(r.groups.UpdateOne(ctx,
+		bson.M{"_id": groupID},
+		bson.M{"$addToSet": bson.M{"customCategories": category}},
+	))
+}
+
+func (r *mongoGroupRepository) RemoveCategory(ctx context.Context, groupID primitive.ObjectID, category string) error {
+	return checkMatched(r.groups.UpdateOne(ctx,
+		bson.M{"_id": groupID},
+		bson.M{"$pull": bson.M{"customCategories": category}},
+	))
+}
+
+func (r *mongoGroupRepository) SetSettlementRules(ctx context.Context, groupID primitive.ObjectID, rules *models.SettlementRules) error {
+	update := bson.M{"$set": bson.M{"settlementRules": rules}}
+	if rules == nil {
+		update = bson.M{"$unset": bson.M{"settlementRules": ""}}
+	}
+	return checkMatched(r.groups.UpdateOne(ctx, bson.M{"_id": groupID}, update))
+}
+
+func (r *mongoGroupRepository) AddGuest(ctx context.Context, groupID primitive.ObjectID, guest models.GuestMember) error {
+	return checkMatched(r.groups.UpdateOne(ctx,
+		bson.M{"_id": groupID},
+		bson.M{"$push": bson.M{"guests": guest}},
+	))
+}
+
+func (r *mongoGroupRepository) RemoveGuest(ctx context.Context, groupID, guestID primitive.ObjectID) error {
+	return checkMatched(r.groups.UpdateOne(ctx,
+		bson.M{"_id": groupID},
+		bson.M{"$pull": bson.M{"guests": bson.M{"_id": guestID}}},
+	))
+}
+
+func (r *mongoGroupRepository) SetRoles(ctx context.Context, groupID primitive.ObjectID, roles map[primitive.ObjectID]string) error {
+	set := bson.M{}
+	for userID, role := range roles {
+		set["roles."+userID.Hex()] = role
+	}
+	return checkMatched(r.groups.UpdateOne(ctx,
+		bson.M{"_id": groupID},
+		bson.M{"$set": set},
+	))
+}
+
+type mongoExpenseRepository struct {
+	expenses *mongo.Collection
+	history  *mongo.Collection
+}
+
+func (r *mongoExpenseRepository) Create(ctx context.Context, expense *models.Expense) error {
+	_, err := r.expenses.InsertOne(ctx, expense)
+	return err
+}
+
+func (r *mongoExpenseRepository) CreateMany(ctx context.Context, expenses []models.Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(expenses))
+	for i, expense := range expenses {
+		docs[i] = expense
+	}
+	_, err := r.expenses.InsertMany(ctx, docs)
+	return err
+}
+
+func (r *mongoExpenseRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Expense, error) {
+	return findOne[models.Expense](ctx, r.expenses, bson.M{"_id": id})
+}
+
+func (r *mongoExpenseRepository) FindByGroup(ctx context.Context, groupID primitive.ObjectID) ([]models.Expense, error) {
+	return findAll[models.Expense](ctx, r.expenses, bson.M{"groupId": groupID})
+}
+
+// BalanceTotals computes both sides of every balance in a single aggregation:
+// one facet sums payer contributions, the other joins the splits. Expenses
+// logged before currencies were tracked count their plain amounts, which may
+// still be stored as doubles in whole units.
+func (r *mongoExpenseRepository) BalanceTotals(ctx context.Context, groupID primitive.ObjectID) ([]models.UserTotals, error) {
+	paid := append(expensePaidStages(),
+		bson.M{"$group": bson.M{"_id": "$contributions.userId", "total": bson.M{"$sum": "$contributions.amount"}}},
+	)
+	owed := append(expenseOwedStages(),
+		bson.M{"$group": bson.M{"_id": "$splits.userId", "total": bson.M{"$sum": "$_owed"}}},
+	)
+
+	side := func(facet, field string) bson.M {
+		return bson.M{"$map": bson.M{
+			"input": "$" + facet,
+			"as":    "t",
+			"in":    bson.M{"userId": "$$t._id", "paid": 0, "owed": 0, field: "$$t.total"},
+		}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"groupId": groupID}}},
+		{{Key: "$facet", Value: bson.M{"paid": paid, "owed": owed}}},
+		{{Key: "$project", Value: bson.M{"totals": bson.M{"$concatArrays": bson.A{side("paid", "paid"), side("owed", "owed")}}}}},
+		{{Key: "$unwind", Value: "$totals"}},
+		{{Key: "$group", Value: bson.M{
+			"_id":  "$totals.userId",
+			"paid": bson.M{"$sum": "$totals.paid"},
+			"owed": bson.M{"$sum": "$totals.owed"},
+		}}},
+		// Whole cents as int64, so Money does not mistake them for legacy doubles
+		{{Key: "$project", Value: bson.M{"paid": bson.M{"$toLong": "$paid"}, "owed": bson.M{"$toLong": "$owed"}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := r.expenses.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := []models.UserTotals{}
+	if err = cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+// mongoLegacyExpense matches expenses stored before currencies were tracked,
+// whose amounts are already in the base currency
+var mongoLegacyExpense = bson.M{"$not": bson.A{bson.M{"$gt": bson.A{"$currency", ""}}}}
+
+// expensePaidStages turns every expense into one document per payer, with
+// contributions.userId and contributions.amount in the base currency
+func expensePaidStages() bson.A {
+	paidBy := func(amount interface{}) bson.A {
+		return bson.A{bson.M{"userId": "$paidBy", "amount": amount}}
+	}
+	return bson.A{
+		bson.M{"$addFields": bson.M{"contributions": bson.M{"$switch": bson.M{
+			"branches": bson.A{
+				bson.M{"case": mongoLegacyExpense, "then": paidBy(mongoMoney("$amount"))},
+				bson.M{"case": bson.M{"$eq": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$payers", bson.A{}}}}, 0}}, "then": paidBy(mongoMoney("$baseAmount"))},
+			},
+			"default": bson.M{"$map": bson.M{
+				"input": "$payers",
+				"as":    "payer",
+				"in":    bson.M{"userId": "$$payer.userId", "amount": mongoMoney("$$payer.baseAmount")},
+			}},
+		}}}},
+		bson.M{"$unwind": "$contributions"},
+	}
+}
+
+// expenseOwedStages turns every expense into one document per split, with
+// splits.userId and the share owed in the base currency as _owed
+func expenseOwedStages() bson.A {
+	return bson.A{
+		bson.M{"$lookup": bson.M{"from": "splits", "localField": "_id", "foreignField": "expenseId", "as": "splits"}},
+		bson.M{"$unwind": "$splits"},
+		bson.M{"$addFields": bson.M{"_owed": bson.M{"$cond": bson.A{
+			mongoLegacyExpense, mongoMoney("$splits.amount"), mongoMoney("$splits.baseAmount"),
+		}}}},
+	}
+}
+
+// mongoTotals groups documents by key into models.ExpenseTotal, summing
+// amount. Sums are converted to whole cents as int64, so Money does not
+// mistake them for legacy doubles.
+func mongoTotals(key, amount interface{}, sort bson.D) bson.A {
+	return bson.A{
+		bson.M{"$group": bson.M{"_id": key, "total": bson.M{"$sum": amount}, "count": bson.M{"$sum": 1}}},
+		bson.M{"$project": bson.M{"total": bson.M{"$toLong": "$total"}, "count": 1}},
+		bson.M{"$sort": sort},
+	}
+}
+
+// asStages converts a pipeline so stages written as bson.M can be appended
+func asStages(pipeline mongo.Pipeline) bson.A {
+	stages := bson.A{}
+	for _, stage := range pipeline {
+		stages = append(stages, stage)
+	}
+	return stages
+}
+
+// byTotalDesc sorts totals largest first
+var byTotalDesc = bson.D{{Key: "total", Value: -1}, {Key: "_id", Value: 1}}
+
+// mongoMoney is an aggregation expression for a Money field in cents. Amounts
+// written before Money was introduced are doubles in whole units.
+func mongoMoney(field string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$type": field}, "double"}},
+		bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{field, 100}}, 0}},
+		bson.M{"$ifNull": bson.A{field, 0}},
+	}}
+}
+
+// expenseFilter returns the stages selecting the expenses matching query's
+// filters, with the expense date and base currency total added as _date and
+// _baseAmount. extra is matched against the computed fields as well.
+func expenseFilter(query models.ExpenseQuery, extra bson.M) mongo.Pipeline {
+	match := bson.M{"groupId": query.GroupID}
+	if query.PaidBy != nil {
+		match["$or"] = bson.A{bson.M{"paidBy": *query.PaidBy}, bson.M{"payers.userId": *query.PaidBy}}
+	}
+	if query.Category != "" {
+		match["category"] = query.Category
+	}
+	if query.Tag != "" {
+		match["tags"] = query.Tag
+	}
+	if query.Text != "" {
+		match["description"] = bson.M{"$regex": regexp.QuoteMeta(query.Text), "$options": "i"}
+	}
+
+	computed := bson.M{
+		"_date":       bson.M{"$ifNull": bson.A{"$date", "$createdAt"}},
+		"_baseAmount": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$currency", ""}}, "$baseAmount", mongoMoney("$amount")}},
+	}
+
+	computedMatch := bson.M{}
+	for key, value := range extra {
+		computedMatch[key] = value
+	}
+	dateRange := bson.M{}
+	if query.DateFrom != nil {
+		dateRange["$gte"] = *query.DateFrom
+	}
+	if query.DateBefore != nil {
+		dateRange["$lt"] = *query.DateBefore
+	}
+	if len(dateRange) > 0 {
+		computedMatch["_date"] = dateRange
+	}
+	amountRange := bson.M{}
+	if query.MinAmount != nil {
+		amountRange["$gte"] = int64(*query.MinAmount)
+	}
+	if query.MaxAmount != nil {
+		amountRange["$lte"] = int64(*query.MaxAmount)
+	}
+	if len(amountRange) > 0 {
+		computedMatch["_baseAmount"] = amountRange
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: computed}},
+	}
+	if len(computedMatch) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: computedMatch}})
+	}
+	return pipeline
+}
+
+// Search runs as an aggregation so that expenses stored before dates and
+// currencies were tracked can be filtered and sorted like newer ones: their
+// date falls back to createdAt and their amount, possibly a legacy double in
+// whole units, is already in the base currency.
+func (r *mongoExpenseRepository) Search(ctx context.Context, query models.ExpenseQuery) ([]models.Expense, error) {
+	sortField, direction, compare := "_date", -1, "$lt"
+	switch query.SortBy {
+	case models.ExpenseSortAmount:
+		sortField = "_baseAmount"
+	case models.ExpenseSortCreatedAt:
+		sortField = "createdAt"
+	}
+	if query.Ascending {
+		direction, compare = 1, "$gt"
+	}
+	after := bson.M{}
+	if query.After != nil {
+		var value interface{} = query.After.Value
+		if sortField != "_baseAmount" {
+			value = time.UnixMilli(query.After.Value)
+		}
+		after["$or"] = bson.A{
+			bson.M{sortField: bson.M{compare: value}},
+			bson.M{sortField: value, "_id": bson.M{compare: query.After.ID}},
+		}
+	}
+
+	pipeline := append(expenseFilter(query, after),
+		bson.D{{Key: "$sort", Value: bson.D{{Key: sortField, Value: direction}, {Key: "_id", Value: direction}}}},
+		bson.D{{Key: "$limit", Value: query.Limit}},
+		bson.D{{Key: "$project", Value: bson.M{"_date": 0, "_baseAmount": 0}}},
+	)
+
+	cursor, err := r.expenses.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	expenses := []models.Expense{}
+	if err = cursor.All(ctx, &expenses); err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+func (r *mongoExpenseRepository) Totals(ctx context.Context, query models.ExpenseQuery, groupBy string) ([]models.ExpenseTotal, error) {
+	pipeline := asStages(expenseFilter(query, nil))
+	key := bson.M{"$ifNull": bson.A{"$category", ""}}
+	if groupBy == models.ExpenseGroupTag {
+		pipeline = append(pipeline, bson.M{"$unwind": "$tags"})
+		key = bson.M{"$ifNull": bson.A{"$tags", ""}}
+	}
+	pipeline = append(pipeline, mongoTotals(key, "$_baseAmount", byTotalDesc)...)
+
+	cursor, err := r.expenses.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := []models.ExpenseTotal{}
+	if err = cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+func (r *mongoExpenseRepository) Report(ctx context.Context, query models.ExpenseQuery) (*models.ExpenseReport, error) {
+	userKey := func(field string) bson.M { return bson.M{"$toString": field} }
+	month := bson.M{"$dateToString": bson.M{"format": "%Y-%m", "date": "$_date"}}
+
+	pipeline := append(asStages(expenseFilter(query, nil)),
+		bson.M{"$facet": bson.M{
+			"summary":    mongoTotals(nil, "$_baseAmount", byTotalDesc),
+			"byCategory": mongoTotals(bson.M{"$ifNull": bson.A{"$category", ""}}, "$_baseAmount", byTotalDesc),
+			"byPayer":    append(expensePaidStages(), mongoTotals(userKey("$contributions.userId"), "$contributions.amount", byTotalDesc)...),
+			"byMember":   append(expenseOwedStages(), mongoTotals(userKey("$splits.userId"), "$_owed", byTotalDesc)...),
+			"byMonth":    mongoTotals(month, "$_baseAmount", bson.D{{Key: "_id", Value: 1}}),
+		}},
+	)
+
+	cursor, err := r.expenses.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Summary              []models.ExpenseTotal `bson:"summary"`
+		models.ExpenseReport `bson:",inline"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	report := &models.ExpenseReport{}
+	if len(results) > 0 {
+		*report = results[0].ExpenseReport
+		if len(results[0].Summary) > 0 {
+			report.Total = results[0].Summary[0].Total
+			report.Count = results[0].Summary[0].Count
+		}
+	}
+	return report, nil
+}
+
+func (r *mongoExpenseRepository) Each(ctx context.Context, query models.ExpenseQuery, fn func(expense models.Expense, splits []models.Split) error) error {
+	pipeline := append(asStages(expenseFilter(query, nil)),
+		bson.M{"$sort": bson.D{{Key: "_date", Value: 1}, {Key: "_id", Value: 1}}},
+		bson.M{"$lookup": bson.M{"from": "splits", "localField": "_id", "foreignField": "expenseId", "as": "_splits"}},
+		bson.M{"$project": bson.M{"_date": 0, "_baseAmount": 0}},
+	)
+
+	cursor, err := r.expenses.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			models.Expense `bson:",inline"`
+			Splits         []models.Split `bson:"_splits"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(doc.Expense, doc.Splits); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (r *mongoExpenseRepository) Replace(ctx context.Context, expense *models.Expense) error {
+	result, err := r.expenses.ReplaceOne(ctx, bson.M{"_id": expense.ID}, expense)
+	return checkMatched(result, err)
+}
+
+func (r *mongoExpenseRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.expenses.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoExpenseRepository) SaveRevision(ctx context.Context, revision *models.ExpenseRevision) error {
+	_, err := r.history.InsertOne(ctx, revision)
+	return err
+}
+
+func (r *mongoExpenseRepository) FindRevisions(ctx context.Context, groupID primitive.ObjectID, expenseID *primitive.ObjectID) ([]models.ExpenseRevision, error) {
+	filter := bson.M{"groupId": groupID}
+	if expenseID != nil {
+		filter["expenseId"] = *expenseID
+	}
+	newestFirst := options.Find().SetSort(bson.D{{Key: "changedAt", Value: -1}})
+	return findAll[models.ExpenseRevision](ctx, r.history, filter, newestFirst)
+}
+
+func (r *mongoExpenseRepository) ReassignUser(ctx context.Context, groupID, from, to primitive.ObjectID) error {
+	// Expenses both paid for need their contributions combined
+	both, err := findAll[models.Expense](ctx, r.expenses, bson.M{"groupId": groupID, "payers.userId": bson.M{"$all": bson.A{from, to}}})
+	if err != nil {
+		return err
+	}
+	for _, expense := range both {
+		expense.ReassignPayer(from, to)
+		if _, err := r.expenses.ReplaceOne(ctx, bson.M{"_id": expense.ID}, expense); err != nil {
+			return err
+		}
+	}
+
+	_, err = r.expenses.UpdateMany(ctx,
+		bson.M{"groupId": groupID, "paidBy": from},
+		bson.M{"$set": bson.M{"paidBy": to}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = r.expenses.UpdateMany(ctx,
+		bson.M{"groupId": groupID, "payers.userId": from},
+		bson.M{"$set": bson.M{"payers.$[payer].userId": to}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"payer.userId": from}}}),
+	)
+	return err
+}
+
+type mongoSplitRepository struct {
+	splits *mongo.Collection
+}
+
+func (r *mongoSplitRepository) CreateMany(ctx context.Context, splits []models.Split) error {
+	if len(splits) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(splits))
+	for i, split := range splits {
+		docs[i] = split
+	}
+	_, err := r.splits.InsertMany(ctx, docs)
+	return err
+}
+
+func (r *mongoSplitRepository) FindByExpense(ctx context.Context, expenseID primitive.ObjectID) ([]models.Split, error) {
+	return findAll[models.Split](ctx, r.splits, bson.M{"expenseId": expenseID})
+}
+
+func (r *mongoSplitRepository) DeleteByExpense(ctx context.Context, expenseID primitive.ObjectID) error {
+	_, err := r.splits.DeleteMany(ctx, bson.M{"expenseId": expenseID})
+	return err
+}
+
+func (r *mongoSplitRepository) ReassignUser(ctx context.Context, expenseIDs []primitive.ObjectID, from, to primitive.ObjectID) error {
+	if len(expenseIDs) == 0 {
+		return nil
+	}
+
+	// Where both have a share of the same expense, to's absorbs from's
+	splits, err := findAll[models.Split](ctx, r.splits, bson.M{"expenseId": bson.M{"$in": expenseIDs}, "userId": bson.M{"$in": bson.A{from, to}}})
+	if err != nil {
+		return err
+	}
+	shares := make(map[primitive.ObjectID]primitive.ObjectID)
+	for _, split := range splits {
+		if split.UserID == to {
+			shares[split.ExpenseID] = split.ID
+		}
+	}
+	for _, split := range splits {
+		shareID, ok := shares[split.ExpenseID]
+		if split.UserID != from || !ok {
+			continue
+		}
+		_, err := r.splits.UpdateOne(ctx,
+			bson.M{"_id": shareID},
+			bson.M{"$inc": bson.M{"amount": split.Amount, "baseAmount": split.BaseAmount}},
+		)
+		if err != nil {
+			return err
+		}
+		if _, err := r.splits.DeleteOne(ctx, bson.M{"_id": split.ID}); err != nil {
+			return err
+		}
+	}
+
+	_, err = r.splits.UpdateMany(ctx,
+		bson.M{"expenseId": bson.M{"$in": expenseIDs}, "userId": from},
+		bson.M{"$set": bson.M{"userId": to}},
+	)
+	return err
+}
+
+type mongoSettlementRepository struct {
+	settlements *mongo.Collection
+}
+
+func (r *mongoSettlementRepository) Create(ctx context.Context, settlement *models.Settlement) error {
+	_, err := r.settlements.InsertOne(ctx, settlement)
+	return err
+}
+
+func (r *mongoSettlementRepository) FindByGroup(ctx context.Context, groupID primitive.ObjectID) ([]models.Settlement, error) {
+	newestFirst := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	return findAll[models.Settlement](ctx, r.settlements, bson.M{"groupId": groupID}, newestFirst)
+}
+
+func (r *mongoSettlementRepository) ReassignUser(ctx context.Context, groupID, from, to primitive.ObjectID) error {
+	_, err := r.settlements.DeleteMany(ctx, bson.M{
+		"groupId": groupID,
+		"$or": bson.A{
+			bson.M{"fromUser": from, "toUser": to},
+			bson.M{"fromUser": to, "toUser": from},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, field := range []string{"fromUser", "toUser"} {
+		_, err := r.settlements.UpdateMany(ctx,
+			bson.M{"groupId": groupID, field: from},
+			bson.M{"$set": bson.M{field: to}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type mongoFXRateRepository struct {
+	rates *mongo.Collection
+}
+
+func (r *mongoFXRateRepository) Upsert(ctx context.Context, rates []models.FXRate) error {
+	writes := make([]mongo.WriteModel, 0, len(rates))
+	for _, rate := range rates {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"base": rate.Base, "quote": rate.Quote, "date": rate.Date}).
+			SetUpdate(bson.M{
+				"$set":         bson.M{"rate": rate.Rate, "source": rate.Source, "createdAt": rate.CreatedAt},
+				"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+			}).
+			SetUpsert(true))
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	_, err := r.rates.BulkWrite(ctx, writes)
+	return err
+}
+
+func (r *mongoFXRateRepository) FindLatest(ctx context.Context, base, quote string, at time.Time) (*models.FXRate, error) {
+	cursor, err := r.rates.Find(ctx,
+		bson.M{"base": base, "quote": quote, "date": bson.M{"$lte": at}},
+		options.Find().SetSort(bson.D{{Key: "date", Value: -1}}).SetLimit(1),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	var rate models.FXRate
+	if err := cursor.Decode(&rate); err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+func (r *mongoFXRateRepository) List(ctx context.Context, base, quote string) ([]models.FXRate, error) {
+	filter := bson.M{}
+	if base != "" {
+		filter["base"] = base
+	}
+	if quote != "" {
+		filter["quote"] = quote
+	}
+	newestFirst := options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "base", Value: 1}, {Key: "quote", Value: 1}})
+	return findAll[models.FXRate](ctx, r.rates, filter, newestFirst)
+}
+
+type mongoTokenRepository struct {
+	refreshTokens *mongo.Collection
+	revokedTokens *mongo.Collection
+}
+
+func (r *mongoTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	_, err := r.refreshTokens.InsertOne(ctx, token)
+	return err
+}
+
+func (r *mongoTokenRepository) FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	return findOne[models.RefreshToken](ctx, r.refreshTokens, bson.M{"tokenHash": tokenHash})
+}
+
+func (r *mongoTokenRepository) RevokeRefreshToken(ctx context.Context, id primitive.ObjectID, replacedBy *primitive.ObjectID, at time.Time) error {
+	set := bson.M{"revokedAt": at}
+	if replacedBy != nil {
+		set["replacedBy"] = *replacedBy
+	}
+	return checkMatched(r.refreshTokens.UpdateOne(ctx,
+		bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": set},
+	))
+}
+
+func (r *mongoTokenRepository) RevokeRefreshFamily(ctx context.Context, familyID primitive.ObjectID, at time.Time) error {
+	_, err := r.refreshTokens.UpdateMany(ctx,
+		bson.M{"familyId": familyID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": at}},
+	)
+	return err
+}
+
+func (r *mongoTokenRepository) RevokeAccessToken(ctx context.Context, token *models.RevokedToken) error {
+	_, err := r.revokedTokens.InsertOne(ctx, token)
+	return err
+}
+
+func (r *mongoTokenRepository) IsAccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	count, err := r.revokedTokens.CountDocuments(ctx, bson.M{"jti": tokenID}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+type mongoInvitationRepository struct {
+	invitations *mongo.Collection
+}
+
+func (r *mongoInvitationRepository) Create(ctx context.Context, invitation *models.Invitation) error {
+	_, err := r.invitations.InsertOne(ctx, invitation)
+	return err
+}
+
+func (r *mongoInvitationRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Invitation, error) {
+	return findOne[models.Invitation](ctx, r.invitations, bson.M{"_id": id})
+}
+
+func (r *mongoInvitationRepository) FindPendingByEmail(ctx context.Context, email string, now time.Time) ([]models.Invitation, error) {
+	return findAll[models.Invitation](ctx, r.invitations, bson.M{
+		"email":      email,
+		"acceptedAt": bson.M{"$exists": false},
+		"expiresAt":  bson.M{"$gt": now},
+	})
+}
+
+func (r *mongoInvitationRepository) MarkAccepted(ctx context.Context, id, userID primitive.ObjectID, at time.Time) error {
+	return checkMatched(r.invitations.UpdateOne(ctx,
+		bson.M{"_id": id, "acceptedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"acceptedAt": at, "acceptedBy": userID}},
+	))
+}
+
+type mongoBalanceRepository struct {
+	balances *mongo.Collection
+}
+
+func (r *mongoBalanceRepository) FindByGroup(ctx context.Context, groupID primitive.ObjectID) (*models.GroupBalance, error) {
+	return findOne[models.GroupBalance](ctx, r.balances, bson.M{"_id": groupID})
+}
+
+func (r *mongoBalanceRepository) Apply(ctx context.Context, groupID primitive.ObjectID, deltas map[string]models.Money) error {
+	inc := bson.M{}
+	for userID, delta := range deltas {
+		if delta != 0 {
+			inc["balances."+userID] = delta
+		}
+	}
+	// Even without deltas the document is written, so a missing one is still
+	// reported. No upsert: a missing document means the balances were never built
+	update := bson.M{"$set": bson.M{"updatedAt": time.Now()}}
+	if len(inc) > 0 {
+		update["$inc"] = inc
+	}
+	result, err := r.balances.UpdateOne(ctx, bson.M{"_id": groupID}, update)
+	return checkMatched(result, err)
+}
+
+func (r *mongoBalanceRepository) Replace(ctx context.Context, balance *models.GroupBalance) error {
+	_, err := r.balances.ReplaceOne(ctx, bson.M{"_id": balance.GroupID}, balance, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"expensetracker/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound is returned when a requested document does not exist
+var ErrNotFound = errors.New("document not found")
+
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	AddGroup(ctx context.Context, userID, groupID primitive.ObjectID) error
+	RemoveGroup(ctx context.Context, userID, groupID primitive.ObjectID) error
+}
+
+type GroupRepository interface {
+	Create(ctx context.Context, group *models.Group) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Group, error)
+	// FindByMember returns every group the user is a member of
+	FindByMember(ctx context.Context, userID primitive.ObjectID) ([]models.Group, error)
+	AddMember(ctx context.Context, groupID, userID primitive.ObjectID, role string) error
+	// RemoveMember drops a member and their role and records them as a former member
+	RemoveMember(ctx context.Context, groupID, userID primitive.ObjectID) error
+	Rename(ctx context.Context, groupID primitive.ObjectID, name string) error
+	AddGuest(ctx context.Context, groupID primitive.ObjectID, guest models.GuestMember) error
+	RemoveGuest(ctx context.Context, groupID, guestID primitive.ObjectID) error
+	// SetRoles updates the roles of the given members, leaving the others as they are
+	SetRoles(ctx context.Context, groupID primitive.ObjectID, roles map[primitive.ObjectID]string) error
+	AddCategory(ctx context.Context, groupID primitive.ObjectID, category string) error
+	RemoveCategory(ctx context.Context, groupID primitive.ObjectID, category string) error
+	// SetSettlementRules replaces the group's settlement rules; nil removes them
+	SetSettlementRules(ctx context.Context, groupID primitive.ObjectID, rules *models.SettlementRules) error
+}
+
+type ExpenseRepository interface {
+	Create(ctx context.Context, expense *models.Expense) error
+	// CreateMany stores several expenses in one round trip
+	CreateMany(ctx context.Context, expenses []models.Expense) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Expense, error)
+	FindByGroup(ctx context.Context, groupID primitive.ObjectID) ([]models.Expense, error)
+	// BalanceTotals sums, per user, what they paid and what they owe over
+	// every expense of the group, in one round trip
+	BalanceTotals(ctx context.Context, groupID primitive.ObjectID) ([]models.UserTotals, error)
+	// Search returns the expenses matching query, in its sort order, at most query.Limit
+	Search(ctx context.Context, query models.ExpenseQuery) ([]models.Expense, error)
+	// Totals sums the expenses matching query's filters per category or tag
+	// (models.ExpenseGroupCategory or ExpenseGroupTag), largest total first.
+	// Sorting, cursor and limit are ignored.
+	Totals(ctx context.Context, query models.ExpenseQuery, groupBy string) ([]models.ExpenseTotal, error)
+	// Report summarizes the expenses matching query's filters by category,
+	// payer, member share and month
+	Report(ctx context.Context, query models.ExpenseQuery) (*models.ExpenseReport, error)
+	// Each calls fn with every expense matching query's filters and its
+	// splits, oldest first, reading them from the database as it goes.
+	// Sorting, cursor and limit are ignored. It stops at the first error fn
+	// returns.
+	Each(ctx context.Context, query models.ExpenseQuery, fn func(expense models.Expense, splits []models.Split) error) error
+	Replace(ctx context.Context, expense *models.Expense) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	SaveRevision(ctx context.Context, revision *models.ExpenseRevision) error
+	// ReassignUser replaces from with to as payer of every expense in the
+	// group, combining their contributions where both paid
+	ReassignUser(ctx context.Context, groupID, from, to primitive.ObjectID) error
+	// FindRevisions returns the history of a group, newest first, optionally
+	// narrowed down to a single expense
+	FindRevisions(ctx context.Context, groupID primitive.ObjectID, expenseID *primitive.ObjectID) ([]models.ExpenseRevision, error)
+}
+
+type SplitRepository interface {
+	CreateMany(ctx context.Context, splits []models.Split) error
+	FindByExpense(ctx context.Context, expenseID primitive.ObjectID) ([]models.Split, error)
+	DeleteByExpense(ctx context.Context, expenseID primitive.ObjectID) error
+	// ReassignUser moves from's splits of the given expenses to to, adding
+	// them to to's own split of the same expense if there is one
+	ReassignUser(ctx context.Context, expenseIDs []primitive.ObjectID, from, to primitive.ObjectID) error
+}
+
+type SettlementRepository interface {
+	Create(ctx context.Context, settlement *models.Settlement) error
+	// FindByGroup returns the payments recorded in a group, newest first
+	FindByGroup(ctx context.Context, groupID primitive.ObjectID) ([]models.Settlement, error)
+	// ReassignUser replaces from with to as payer or recipient of the group's
+	// payments. Payments between from and to are deleted: they would become
+	// payments to oneself, which leave every balance unchanged.
+	ReassignUser(ctx context.Context, groupID, from, to primitive.ObjectID) error
+}
+
+type FXRateRepository interface {
+	// Upsert stores rates, replacing any existing rate for the same pair and day
+	Upsert(ctx context.Context, rates []models.FXRate) error
+	// FindLatest returns the most recent base/quote rate dated at or before at
+	FindLatest(ctx context.Context, base, quote string, at time.Time) (*models.FXRate, error)
+	// List returns stored rates, newest first. Empty base or quote match any.
+	List(ctx context.Context, base, quote string) ([]models.FXRate, error)
+}
+
+type InvitationRepository interface {
+	Create(ctx context.Context, invitation *models.Invitation) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Invitation, error)
+	// FindPendingByEmail returns the unaccepted, unexpired invitations for an email
+	FindPendingByEmail(ctx context.Context, email string, now time.Time) ([]models.Invitation, error)
+	// MarkAccepted returns ErrNotFound if the invitation was already accepted
+	MarkAccepted(ctx context.Context, id, userID primitive.ObjectID, at time.Time) error
+}
+
+type BalanceRepository interface {
+	FindByGroup(ctx context.Context, groupID primitive.ObjectID) (*models.GroupBalance, error)
+	// Apply adds deltas to a group's stored balances. It returns ErrNotFound
+	// if the group has no stored balances yet, even when every delta is zero.
+	Apply(ctx context.Context, groupID primitive.ObjectID, deltas map[string]models.Money) error
+	// Replace stores a group's balances, overwriting any existing ones
+	Replace(ctx context.Context, balance *models.GroupBalance) error
+}
+
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	FindRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	// RevokeRefreshToken marks a token as used or revoked. It returns
+	// ErrNotFound if the token does not exist or was already revoked, so two
+	// concurrent refreshes with the same token cannot both succeed.
+	RevokeRefreshToken(ctx context.Context, id primitive.ObjectID, replacedBy *primitive.ObjectID, at time.Time) error
+	RevokeRefreshFamily(ctx context.Context, familyID primitive.ObjectID, at time.Time) error
+	RevokeAccessToken(ctx context.Context, token *models.RevokedToken) error
+	IsAccessTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+// Store bundles the repositories of one storage backend
+type Store struct {
+	Users       UserRepository
+	Groups      GroupRepository
+	Expenses    ExpenseRepository
+	Splits      SplitRepository
+	Settlements SettlementRepository
+	FXRates     FXRateRepository
+	Balances    BalanceRepository
+	Tokens      TokenRepository
+	Invitations InvitationRepository
+
+	withTransaction func(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// WithTransaction runs fn so that either all of its writes are persisted or
+// none are. Repository calls inside fn must use the context passed to it.
+func (s *Store) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.withTransaction(ctx, fn)
+}
+
+var current *Store
+
+// Init sets the store used by the rest of the application
+func Init(store *Store) {
+	current = store
+}
+
+// Get returns the store configured with Init
+func Get() *Store {
+	return current
+}
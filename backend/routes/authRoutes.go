@@ -2,6 +2,7 @@ package routes
 
 import (
 	"expensetracker/controllers"
+	"expensetracker/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,5 +12,7 @@ func SetupAuthRoutes(router *gin.Engine) {
 	{
 		authGroup.POST("/signup", controllers.Register)
 		authGroup.POST("/login", controllers.Login)
+		authGroup.POST("/refresh", controllers.RefreshToken)
+		authGroup.POST("/logout", middleware.AuthMiddleware(), controllers.Logout)
 	}
 }
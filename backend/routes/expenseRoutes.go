@@ -12,6 +12,10 @@ func SetupExpenseRoutes(router *gin.Engine) {
 	expenseRoutes.Use(middleware.AuthMiddleware())
 	{
 		expenseRoutes.POST("", controllers.AddExpense)
-		expenseRoutes.GET("/:groupId", controllers.GetGroupExpenses)
+		expenseRoutes.GET("/:groupId", middleware.GroupMember("groupId"), controllers.GetGroupExpenses)
+		expenseRoutes.GET("/:groupId/totals", middleware.GroupMember("groupId"), controllers.GetExpenseTotals)
+		expenseRoutes.GET("/:groupId/history", middleware.GroupMember("groupId"), controllers.GetExpenseHistory)
+		expenseRoutes.PUT("/:id", controllers.UpdateExpense)
+		expenseRoutes.DELETE("/:id", controllers.DeleteExpense)
 	}
 }
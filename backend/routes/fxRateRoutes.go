@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"expensetracker/controllers"
+	"expensetracker/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupFXRateRoutes(router *gin.Engine) {
+	fxRateRoutes := router.Group("/api/fx-rates")
+	fxRateRoutes.Use(middleware.AuthMiddleware())
+	{
+		fxRateRoutes.GET("", controllers.GetFXRates)
+
+		// Rates are shared by every group, so only system administrators may change them
+		fxRateRoutes.POST("", middleware.SystemAdmin(), controllers.UploadFXRates)
+		fxRateRoutes.POST("/import", middleware.SystemAdmin(), controllers.ImportFXRates)
+	}
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"expensetracker/controllers"
 	"expensetracker/middleware"
+	"expensetracker/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,8 +13,24 @@ func SetupGroupRoutes(router *gin.Engine) {
 	groupRoutes.Use(middleware.AuthMiddleware())
 	{
 		groupRoutes.POST("", controllers.CreateGroup)
-		groupRoutes.POST("/:id/members", controllers.AddMember)
-		groupRoutes.GET("/:id", controllers.GetGroupDetails)
+		groupRoutes.POST("/:id/members", middleware.GroupMember("id"), middleware.GroupRole(models.RoleAdmin), controllers.AddMember)
+		groupRoutes.DELETE("/:id/members/:userId", middleware.GroupMember("id"), middleware.GroupRole(models.RoleAdmin), controllers.RemoveMember)
+		groupRoutes.POST("/:id/invites", middleware.GroupMember("id"), middleware.GroupRole(models.RoleAdmin), controllers.CreateInvitation)
+		groupRoutes.POST("/:id/guests", middleware.GroupMember("id"), middleware.GroupRole(models.RoleMember), controllers.AddGuest)
+		groupRoutes.POST("/:id/guests/:guestId/merge", middleware.GroupMember("id"), middleware.GroupRole(models.RoleAdmin), controllers.MergeGuest)
+		groupRoutes.POST("/:id/leave", middleware.GroupMember("id"), controllers.LeaveGroup)
+		groupRoutes.PUT("/:id/members/:userId/role", middleware.GroupMember("id"), middleware.GroupRole(models.RoleAdmin), controllers.UpdateMemberRole)
+		groupRoutes.POST("/:id/transfer-ownership", middleware.GroupMember("id"), middleware.GroupRole(models.RoleOwner), controllers.TransferOwnership)
+		groupRoutes.POST("/:id/import", middleware.GroupMember("id"), middleware.GroupRole(models.RoleMember), controllers.ImportExpenses)
+		groupRoutes.GET("/:id/export", middleware.GroupMember("id"), controllers.ExportGroup)
+		groupRoutes.GET("/:id/reports", middleware.GroupMember("id"), controllers.GetGroupReport)
+		groupRoutes.GET("/:id/categories", middleware.GroupMember("id"), controllers.GetCategories)
+		groupRoutes.POST("/:id/categories", middleware.GroupMember("id"), middleware.GroupRole(models.RoleAdmin), controllers.AddCategory)
+		groupRoutes.DELETE("/:id/categories/:name", middleware.GroupMember("id"), middleware.GroupRole(models.RoleAdmin), controllers.RemoveCategory)
+		groupRoutes.GET("/:id/settlement-rules", middleware.GroupMember("id"), controllers.GetSettlementRules)
+		groupRoutes.PUT("/:id/settlement-rules", middleware.GroupMember("id"), middleware.GroupRole(models.RoleAdmin), controllers.UpdateSettlementRules)
+		groupRoutes.GET("/:id", middleware.GroupMember("id"), controllers.GetGroupDetails)
+		groupRoutes.PATCH("/:id", middleware.GroupMember("id"), middleware.GroupRole(models.RoleAdmin), controllers.UpdateGroup)
 		groupRoutes.GET("", controllers.GetUserGroups)
 	}
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"expensetracker/controllers"
+	"expensetracker/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupInvitationRoutes(router *gin.Engine) {
+	invitationRoutes := router.Group("/api/invites")
+	invitationRoutes.Use(middleware.AuthMiddleware())
+	{
+		invitationRoutes.POST("/:token/accept", controllers.AcceptInvitation)
+	}
+}
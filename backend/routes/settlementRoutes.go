@@ -3,6 +3,7 @@ package routes
 import (
 	"expensetracker/controllers"
 	"expensetracker/middleware"
+	"expensetracker/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,6 +12,11 @@ func SetupSettlementRoutes(router *gin.Engine) {
 	settlementRoutes := router.Group("/api/settlements")
 	settlementRoutes.Use(middleware.AuthMiddleware())
 	{
-		settlementRoutes.GET("/:groupId", controllers.GetSettlements)
+		settlementRoutes.POST("", controllers.RecordSettlement)
+		settlementRoutes.GET("/me", controllers.GetMyBalances)
+		settlementRoutes.POST("/me/payments", controllers.PayAcrossGroups)
+		settlementRoutes.GET("/:groupId", middleware.GroupMember("groupId"), controllers.GetSettlements)
+		settlementRoutes.POST("/:groupId/rebuild", middleware.GroupMember("groupId"), middleware.GroupRole(models.RoleAdmin), controllers.RebuildBalances)
+		settlementRoutes.GET("/:groupId/payments", middleware.GroupMember("groupId"), controllers.GetSettlementHistory)
 	}
 }
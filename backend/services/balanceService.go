@@ -0,0 +1,45 @@
+package services
+
+import (
+	"expensetracker/models"
+)
+
+// Balances map a user ID (hex string) to their net position in the group's
+// base currency. Positive means they get money back, negative means they owe.
+type Balances map[string]models.Money
+
+// ApplyExpense credits every payer with their contribution and debits every
+// participant their split
+func (b Balances) ApplyExpense(expense models.Expense, splits []models.Split) {
+	for _, payer := range expense.BasePaid() {
+		b[payer.UserID.Hex()] += payer.BaseAmount
+	}
+	for _, split := range splits {
+		b[split.UserID.Hex()] -= expense.BaseOwed(split)
+	}
+}
+
+// RemoveExpense undoes ApplyExpense for an expense that is changed or deleted
+func (b Balances) RemoveExpense(expense models.Expense, splits []models.Split) {
+	for _, payer := range expense.BasePaid() {
+		b[payer.UserID.Hex()] -= payer.BaseAmount
+	}
+	for _, split := range splits {
+		b[split.UserID.Hex()] += expense.BaseOwed(split)
+	}
+}
+
+// ApplyTotals folds in per-user totals of paid and owed amounts, as returned
+// by ExpenseRepository.BalanceTotals
+func (b Balances) ApplyTotals(totals []models.UserTotals) {
+	for _, total := range totals {
+		b[total.UserID.Hex()] += total.Paid - total.Owed
+	}
+}
+
+// ApplySettlement folds in a payment already made: the payer's debt shrinks
+// and the receiver is owed less
+func (b Balances) ApplySettlement(settlement models.Settlement) {
+	b[settlement.FromUser.Hex()] += settlement.Amount
+	b[settlement.ToUser.Hex()] -= settlement.Amount
+}
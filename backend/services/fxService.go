@@ -0,0 +1,144 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"expensetracker/models"
+)
+
+// NormalizeCurrency upper-cases an ISO 4217 code and checks its shape
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("invalid currency code %q", code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("invalid currency code %q", code)
+		}
+	}
+	return code, nil
+}
+
+// ParseDate accepts a plain day (2024-05-31) or a full RFC 3339 timestamp.
+// Plain days are interpreted as midnight UTC.
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	return t.UTC(), nil
+}
+
+// ConvertMoney converts amount at rate, rounding to the nearest cent
+func ConvertMoney(amount models.Money, rate float64) models.Money {
+	return models.Money(math.Round(float64(amount) * rate))
+}
+
+// ConvertExpense fills in the base currency amounts of an expense, its payer
+// contributions and its splits. The converted total is allocated over payers
+// and splits in proportion to their original amounts, so they still add up to
+// exactly the converted total.
+func ConvertExpense(expense *models.Expense, splits []models.Split, rate float64) error {
+	if rate <= 0 {
+		return errors.New("exchange rate must be greater than zero")
+	}
+
+	expense.FXRate = rate
+	expense.BaseAmount = ConvertMoney(expense.Amount, rate)
+
+	if len(expense.Payers) > 0 {
+		weights := make([]int64, len(expense.Payers))
+		for i, payer := range expense.Payers {
+			weights[i] = int64(payer.Amount)
+		}
+		baseAmounts, err := expense.BaseAmount.Allocate(weights)
+		if err != nil {
+			return err
+		}
+		for i := range expense.Payers {
+			expense.Payers[i].BaseAmount = baseAmounts[i]
+		}
+	}
+
+	weights := make([]int64, len(splits))
+	for i, split := range splits {
+		weights[i] = int64(split.Amount)
+	}
+	baseAmounts, err := expense.BaseAmount.Allocate(weights)
+	if err != nil {
+		return err
+	}
+	for i := range splits {
+		splits[i].BaseAmount = baseAmounts[i]
+	}
+	return nil
+}
+
+// ParseFXRatesCSV reads exchange rates from a CSV file with a header row
+// containing the columns date, base, quote and rate (in any order)
+func ParseFXRatesCSV(r io.Reader) ([]models.FXRate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("CSV file is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"date", "base", "quote", "rate"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %q column", required)
+		}
+	}
+
+	var rates []models.FXRate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		date, err := ParseDate(record[columns["date"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		base, err := NormalizeCurrency(record[columns["base"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		quote, err := NormalizeCurrency(record[columns["quote"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[columns["rate"]]), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[columns["rate"]])
+		}
+
+		rates = append(rates, models.FXRate{Base: base, Quote: quote, Rate: rate, Date: date.Truncate(24 * time.Hour)})
+	}
+
+	if len(rates) == 0 {
+		return nil, errors.New("CSV file contains no rates")
+	}
+	return rates, nil
+}
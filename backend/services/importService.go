@@ -0,0 +1,144 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"expensetracker/models"
+)
+
+// MaxImportRows bounds the number of expenses one CSV import may contain
+const MaxImportRows = 5000
+
+const utf8BOM = "\ufeff"
+
+// ImportedPerson is someone named in an import row, by email or guest name,
+// with the amount, percentage or shares given after a colon, if any
+type ImportedPerson struct {
+	Name  string
+	Value string
+}
+
+// ExpenseImportRow is one line of an expense import, parsed but not yet
+// checked against the group
+type ExpenseImportRow struct {
+	Line         int
+	Date         string
+	Payers       []ImportedPerson
+	Amount       models.Money
+	Description  string
+	Currency     string
+	Category     string
+	Tags         []string
+	SplitType    string
+	Participants []ImportedPerson
+	Err          error // Set when the line itself is malformed
+}
+
+// ParseExpenseImportCSV reads an expense import. The header must name the
+// date, payer, amount and description columns; currency, category, tags,
+// split_type and split are optional. Lists (several payers, tags, split
+// participants) are separated by ";" and a person's value follows a colon,
+// e.g. "a@x.io:60;b@x.io:40". Malformed lines are returned with Err set so
+// every problem can be reported at once.
+func ParseExpenseImportCSV(r io.Reader) ([]ExpenseImportRow, error) {
+	// Spreadsheets exporting "CSV UTF-8" start the file with a byte order mark
+	buffered := bufio.NewReader(r)
+	if bom, _ := buffered.Peek(len(utf8BOM)); string(bom) == utf8BOM {
+		buffered.Discard(len(utf8BOM))
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("line 1: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"date", "payer", "amount", "description"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %q column", required)
+		}
+	}
+
+	var rows []ExpenseImportRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("CSV file has more than %d expenses", MaxImportRows)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := ExpenseImportRow{
+			Line:         line,
+			Date:         field("date"),
+			Payers:       parseImportedPeople(field("payer")),
+			Description:  field("description"),
+			Currency:     field("currency"),
+			Category:     field("category"),
+			SplitType:    strings.ToLower(field("split_type")),
+			Participants: parseImportedPeople(field("split")),
+		}
+		for _, tag := range strings.Split(field("tags"), ";") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				row.Tags = append(row.Tags, tag)
+			}
+		}
+
+		switch {
+		case row.Date == "":
+			row.Err = errors.New("date is required")
+		case len(row.Payers) == 0:
+			row.Err = errors.New("payer is required")
+		case row.Description == "":
+			row.Err = errors.New("description is required")
+		default:
+			row.Amount, err = models.ParseMoney(field("amount"))
+			if err != nil || row.Amount <= 0 {
+				row.Err = fmt.Errorf("invalid amount %q", field("amount"))
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("CSV file contains no expenses")
+	}
+	return rows, nil
+}
+
+// parseImportedPeople splits "a@x.io:60;b@x.io:40" into people and values
+func parseImportedPeople(list string) []ImportedPerson {
+	var people []ImportedPerson
+	for _, entry := range strings.Split(list, ";") {
+		name, value, _ := strings.Cut(entry, ":")
+		if name = strings.TrimSpace(name); name != "" {
+			people = append(people, ImportedPerson{Name: name, Value: strings.TrimSpace(value)})
+		}
+	}
+	return people
+}
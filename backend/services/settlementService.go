@@ -1,31 +1,37 @@
 package services
 
 import (
+	"errors"
+	"maps"
+	"math/bits"
+	"slices"
 	"sort"
+
+	"expensetracker/models"
 )
 
 type UserBalance struct {
 	UserID string
-	Amount float64
+	Amount models.Money
 }
 
 type SettlementTransaction struct {
-	FromUser string  `json:"fromUser"`
-	ToUser   string  `json:"toUser"`
-	Amount   float64 `json:"amount"`
+	FromUser string       `json:"fromUser"`
+	ToUser   string       `json:"toUser"`
+	Amount   models.Money `json:"amount"`
 }
 
-// CalculateOptimalSettlements uses a greedy algorithm to minimize transactions
-func CalculateOptimalSettlements(balances map[string]float64) []SettlementTransaction {
+// CalculateOptimalSettlements uses a greedy algorithm to minimize transactions.
+// Balances are integer cents that sum to zero, so no tolerance is needed.
+func CalculateOptimalSettlements(balances map[string]models.Money) []SettlementTransaction {
 	var creditors []UserBalance
 	var debtors []UserBalance
 
 	// Separate into creditors (positive balance) and debtors (negative balance)
 	for userID, amount := range balances {
-		// handle float precision issues
-		if amount > 0.01 {
+		if amount > 0 {
 			creditors = append(creditors, UserBalance{UserID: userID, Amount: amount})
-		} else if amount < -0.01 {
+		} else if amount < 0 {
 			debtors = append(debtors, UserBalance{UserID: userID, Amount: -amount}) // Store as positive debt
 		}
 	}
@@ -34,8 +40,9 @@ func CalculateOptimalSettlements(balances map[string]float64) []SettlementTransa
 
 	// Sort lists to pair largest debtor with largest creditor
 	// Note: While pure greedy doesn't theoretically need sorted lists, sorting often yields more intuitive real-world results
-	sort.Slice(creditors, func(i, j int) bool { return creditors[i].Amount > creditors[j].Amount })
-	sort.Slice(debtors, func(i, j int) bool { return debtors[i].Amount > debtors[j].Amount })
+	// Ties are ordered by user ID so the same balances always produce the same plan
+	sort.Slice(creditors, func(i, j int) bool { return byAmountDesc(creditors[i], creditors[j]) })
+	sort.Slice(debtors, func(i, j int) bool { return byAmountDesc(debtors[i], debtors[j]) })
 
 	i := 0 // debtor index
 	j := 0 // creditor index
@@ -58,11 +65,10 @@ func CalculateOptimalSettlements(balances map[string]float64) []SettlementTransa
 		creditors[j].Amount -= minAmount
 
 		// Move indices if settled
-		// 0.01 tolerance for float precision
-		if debtors[i].Amount < 0.01 {
+		if debtors[i].Amount == 0 {
 			i++
 		}
-		if creditors[j].Amount < 0.01 {
+		if creditors[j].Amount == 0 {
 			j++
 		}
 	}
@@ -70,9 +76,397 @@ func CalculateOptimalSettlements(balances map[string]float64) []SettlementTransa
 	return settlements
 }
 
-func min(a, b float64) float64 {
+func byAmountDesc(a, b UserBalance) bool {
+	if a.Amount != b.Amount {
+		return a.Amount > b.Amount
+	}
+	return a.UserID < b.UserID
+}
+
+func min(a, b models.Money) models.Money {
 	if a < b {
 		return a
 	}
 	return b
 }
+
+// Settlement algorithms. Greedy and exact can be requested; hub and flow
+// are used when the group's settlement constraints call for them.
+const (
+	AlgorithmGreedy = "greedy"
+	AlgorithmExact  = "exact"
+	AlgorithmHub    = "hub"
+	AlgorithmFlow   = "flow"
+)
+
+// ErrNoValidSettlement means no plan can settle the balances without a
+// blocked payment
+var ErrNoValidSettlement = errors.New("no settlement plan satisfies the constraints")
+
+// SettlementConstraints restrict who may pay whom. The zero value allows
+// every payment.
+type SettlementConstraints struct {
+	Blocked   map[string]map[string]bool // Payer -> recipients they cannot pay
+	Preferred map[string][]string        // Payer -> recipients to pay first, in order of preference
+	Hub       string                     // When set, every payment goes to or comes from this user
+}
+
+// Allowed reports whether from may pay to
+func (c *SettlementConstraints) Allowed(from, to string) bool {
+	return c == nil || !c.Blocked[from][to]
+}
+
+func (c *SettlementConstraints) empty() bool {
+	return c == nil || (len(c.Blocked) == 0 && len(c.Preferred) == 0 && c.Hub == "")
+}
+
+// maxConstrainedExactSize bounds the exact search under constraints, which
+// takes O(3^n) time rather than the O(2^n * n) of the unconstrained one
+const maxConstrainedExactSize = 14
+
+// SettleBalances computes a settlement plan with the requested algorithm
+// under the given constraints, which may be nil. The exact solver is
+// exponential in the number of people with a non-zero balance, so above
+// maxExactSize it falls back to the greedy one. The algorithm actually used
+// is returned with the plan.
+//
+// With a hub every debtor pays the hub and the hub pays every creditor.
+// Otherwise the plan is made of direct payments where possible: blocked
+// payments are skipped and preferred recipients are paid first, and the
+// exact solver looks for the fewest such payments. Only when no plan of
+// direct payments exists is it computed as a flow through the allowed
+// payments, where people may have to pass money on. The flow is a best
+// effort and need not use the fewest transfers.
+func SettleBalances(balances map[string]models.Money, algorithm string, maxExactSize int, constraints *SettlementConstraints) ([]SettlementTransaction, string, error) {
+	if constraints.empty() {
+		if algorithm == AlgorithmExact {
+			if transactions, ok := CalculateExactSettlements(balances, maxExactSize); ok {
+				return transactions, AlgorithmExact, nil
+			}
+		}
+		return CalculateOptimalSettlements(balances), AlgorithmGreedy, nil
+	}
+
+	if constraints.Hub != "" {
+		transactions, err := settleThroughHub(balances, constraints)
+		return transactions, AlgorithmHub, err
+	}
+
+	if algorithm == AlgorithmExact {
+		maxSize := maxExactSize
+		if maxSize > maxConstrainedExactSize {
+			maxSize = maxConstrainedExactSize
+		}
+		if transactions, ok := constrainedExactSettlements(balances, maxSize, constraints); ok {
+			return transactions, AlgorithmExact, nil
+		}
+	}
+	if transactions, ok := constrainedSettlements(balances, constraints); ok {
+		return transactions, AlgorithmGreedy, nil
+	}
+
+	// Pass money on through people with an open balance before involving
+	// anyone else
+	open := maps.Clone(balances)
+	maps.DeleteFunc(open, func(_ string, amount models.Money) bool { return amount == 0 })
+	if transactions, err := settleByFlow(open, constraints); err == nil {
+		return transactions, AlgorithmFlow, nil
+	}
+	transactions, err := settleByFlow(balances, constraints)
+	return transactions, AlgorithmFlow, err
+}
+
+// CalculateExactSettlements returns a plan with the fewest possible transfers.
+// ok is false when more than maxSize people have a non-zero balance.
+func CalculateExactSettlements(balances map[string]models.Money, maxSize int) (transactions []SettlementTransaction, ok bool) {
+	subgroups, ok := zeroSumSubgroups(balances, maxSize)
+	if !ok {
+		return nil, false
+	}
+	transactions = []SettlementTransaction{}
+	for _, subgroup := range subgroups {
+		transactions = append(transactions, CalculateOptimalSettlements(subgroup)...)
+	}
+	return transactions, true
+}
+
+// zeroSumSubgroups splits the people with a non-zero balance into as many
+// subgroups whose balances sum to zero as possible.
+//
+// Settling a group of k people whose balances sum to zero takes at most k-1
+// transfers, so settling each subgroup separately needs n minus the number
+// of subgroups transfers, which is the minimum. The subgroups are found with
+// a dynamic program over all subsets, in O(2^n * n) time and O(2^n) memory.
+// ok is false when n exceeds maxSize.
+func zeroSumSubgroups(balances map[string]models.Money, maxSize int) (subgroups []map[string]models.Money, ok bool) {
+	var people []UserBalance
+	for userID, amount := range balances {
+		if amount != 0 {
+			people = append(people, UserBalance{UserID: userID, Amount: amount})
+		}
+	}
+	if len(people) > maxSize {
+		return nil, false
+	}
+	sort.Slice(people, func(i, j int) bool { return people[i].UserID < people[j].UserID })
+
+	n := len(people)
+	full := 1<<n - 1
+	sums := make([]models.Money, full+1)
+	groups := make([]int8, full+1) // Most zero-sum subgroups the subset can be split into
+	last := make([]int8, full+1)   // Person removed to reach that optimum
+	for mask := 1; mask <= full; mask++ {
+		lowest := bits.TrailingZeros(uint(mask))
+		sums[mask] = sums[mask&(mask-1)] + people[lowest].Amount
+		groups[mask] = -1
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && groups[mask^(1<<i)] > groups[mask] {
+				groups[mask] = groups[mask^(1<<i)]
+				last[mask] = int8(i)
+			}
+		}
+		if sums[mask] == 0 {
+			groups[mask]++
+		}
+	}
+
+	// Walk back from everyone; each zero-sum prefix closes a subgroup
+	subgroup := map[string]models.Money{}
+	for mask := full; mask != 0; {
+		i := last[mask]
+		subgroup[people[i].UserID] = people[i].Amount
+		mask ^= 1 << i
+		if sums[mask] == 0 {
+			subgroups = append(subgroups, subgroup)
+			subgroup = map[string]models.Money{}
+		}
+	}
+	return subgroups, true
+}
+
+// constrainedSettlements is the greedy algorithm with constraints: the
+// largest debtor pays their preferred recipients first, then the largest
+// creditors they are allowed to pay. ok is false when a debt is left that
+// no allowed payment can settle.
+func constrainedSettlements(balances map[string]models.Money, constraints *SettlementConstraints) (settlements []SettlementTransaction, ok bool) {
+	var creditors []UserBalance
+	var debtors []UserBalance
+	for userID, amount := range balances {
+		if amount > 0 {
+			creditors = append(creditors, UserBalance{UserID: userID, Amount: amount})
+		} else if amount < 0 {
+			debtors = append(debtors, UserBalance{UserID: userID, Amount: -amount})
+		}
+	}
+	sort.Slice(debtors, func(i, j int) bool { return byAmountDesc(debtors[i], debtors[j]) })
+
+	credit := make(map[string]models.Money, len(creditors))
+	for _, creditor := range creditors {
+		credit[creditor.UserID] = creditor.Amount
+	}
+
+	for _, debtor := range debtors {
+		// Largest remaining credit first, preferred recipients ahead of everyone
+		sort.Slice(creditors, func(i, j int) bool {
+			a, b := creditors[i], creditors[j]
+			return byAmountDesc(UserBalance{a.UserID, credit[a.UserID]}, UserBalance{b.UserID, credit[b.UserID]})
+		})
+		candidates := slices.Clone(constraints.Preferred[debtor.UserID])
+		for _, creditor := range creditors {
+			candidates = append(candidates, creditor.UserID)
+		}
+
+		for _, creditorID := range candidates {
+			if debtor.Amount == 0 {
+				break
+			}
+			if credit[creditorID] == 0 || !constraints.Allowed(debtor.UserID, creditorID) {
+				continue
+			}
+			amount := min(debtor.Amount, credit[creditorID])
+			settlements = append(settlements, SettlementTransaction{FromUser: debtor.UserID, ToUser: creditorID, Amount: amount})
+			debtor.Amount -= amount
+			credit[creditorID] -= amount
+		}
+		if debtor.Amount > 0 {
+			return nil, false
+		}
+	}
+	return settlements, true
+}
+
+// constrainedExactSettlements returns the plan of direct payments with the
+// fewest transfers: it tries every partition of the people with a non-zero
+// balance into zero-sum subgroups, settling each with constrainedSettlements.
+// ok is false when more than maxSize people have a non-zero balance, or when
+// no partition can be settled without a blocked payment.
+func constrainedExactSettlements(balances map[string]models.Money, maxSize int, constraints *SettlementConstraints) (transactions []SettlementTransaction, ok bool) {
+	var people []UserBalance
+	for userID, amount := range balances {
+		if amount != 0 {
+			people = append(people, UserBalance{UserID: userID, Amount: amount})
+		}
+	}
+	if len(people) > maxSize {
+		return nil, false
+	}
+	sort.Slice(people, func(i, j int) bool { return people[i].UserID < people[j].UserID })
+
+	n := len(people)
+	full := 1<<n - 1
+	sums := make([]models.Money, full+1)
+	plans := make([][]SettlementTransaction, full+1) // Plan of each zero-sum subgroup, nil if none
+	for mask := 1; mask <= full; mask++ {
+		lowest := bits.TrailingZeros(uint(mask))
+		sums[mask] = sums[mask&(mask-1)] + people[lowest].Amount
+		if sums[mask] != 0 {
+			continue
+		}
+		subgroup := map[string]models.Money{}
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 {
+				subgroup[people[i].UserID] = people[i].Amount
+			}
+		}
+		if settled, ok := constrainedSettlements(subgroup, constraints); ok {
+			plans[mask] = settled
+		}
+	}
+
+	// fewest[mask] is the fewest transfers settling mask, -1 if impossible;
+	// choice[mask] is the subgroup settled last to reach it. Only subgroups
+	// holding the lowest person of mask are tried, so each partition is seen
+	// once.
+	fewest := make([]int, full+1)
+	choice := make([]int, full+1)
+	for mask := 1; mask <= full; mask++ {
+		fewest[mask] = -1
+		if sums[mask] != 0 {
+			continue
+		}
+		lowest := mask & -mask
+		for sub := mask; sub != 0; sub = (sub - 1) & mask {
+			if sub&lowest == 0 || plans[sub] == nil || fewest[mask^sub] < 0 {
+				continue
+			}
+			if count := fewest[mask^sub] + len(plans[sub]); fewest[mask] < 0 || count < fewest[mask] {
+				fewest[mask], choice[mask] = count, sub
+			}
+		}
+	}
+	if fewest[full] < 0 {
+		return nil, false
+	}
+
+	transactions = []SettlementTransaction{}
+	for mask := full; mask != 0; mask ^= choice[mask] {
+		transactions = append(transactions, plans[choice[mask]]...)
+	}
+	return transactions, true
+}
+
+// settleThroughHub routes every payment through the hub: debtors pay it and
+// it pays creditors, one transfer per person with an open balance
+func settleThroughHub(balances map[string]models.Money, constraints *SettlementConstraints) ([]SettlementTransaction, error) {
+	hub := constraints.Hub
+	settlements := []SettlementTransaction{}
+	for _, userID := range slices.Sorted(maps.Keys(balances)) {
+		amount := balances[userID]
+		switch {
+		case userID == hub || amount == 0:
+			continue
+		case amount < 0:
+			if !constraints.Allowed(userID, hub) {
+				return nil, ErrNoValidSettlement
+			}
+			settlements = append(settlements, SettlementTransaction{FromUser: userID, ToUser: hub, Amount: -amount})
+		default:
+			if !constraints.Allowed(hub, userID) {
+				return nil, ErrNoValidSettlement
+			}
+			settlements = append(settlements, SettlementTransaction{FromUser: hub, ToUser: userID, Amount: amount})
+		}
+	}
+	return settlements, nil
+}
+
+// settleByFlow finds a plan as a maximum flow from the debtors to the
+// creditors over the allowed payments, so money can be passed on by people
+// in between (including people whose own balance is zero). Each pair of
+// people with a net flow between them makes one transfer.
+func settleByFlow(balances map[string]models.Money, constraints *SettlementConstraints) ([]SettlementTransaction, error) {
+	people := slices.Sorted(maps.Keys(balances))
+	n := len(people)
+	source, sink := n, n+1
+
+	var total models.Money
+	capacity := make([][]models.Money, n+2)
+	for i := range capacity {
+		capacity[i] = make([]models.Money, n+2)
+	}
+	for i, userID := range people {
+		if amount := balances[userID]; amount < 0 {
+			capacity[source][i] = -amount
+			total -= amount
+		} else {
+			capacity[i][sink] = amount
+		}
+	}
+	for i, from := range people {
+		for j, to := range people {
+			if i != j && constraints.Allowed(from, to) {
+				capacity[i][j] = total
+			}
+		}
+	}
+
+	// Edmonds-Karp: augment along shortest paths until none is left
+	flow := make([][]models.Money, n+2)
+	for i := range flow {
+		flow[i] = make([]models.Money, n+2)
+	}
+	var sent models.Money
+	for {
+		parent := make([]int, n+2)
+		for i := range parent {
+			parent[i] = -1
+		}
+		parent[source] = source
+		queue := []int{source}
+		for len(queue) > 0 && parent[sink] == -1 {
+			u := queue[0]
+			queue = queue[1:]
+			for v := 0; v < n+2; v++ {
+				if parent[v] == -1 && capacity[u][v]-flow[u][v] > 0 {
+					parent[v] = u
+					queue = append(queue, v)
+				}
+			}
+		}
+		if parent[sink] == -1 {
+			break
+		}
+		amount := total
+		for v := sink; v != source; v = parent[v] {
+			amount = min(amount, capacity[parent[v]][v]-flow[parent[v]][v])
+		}
+		for v := sink; v != source; v = parent[v] {
+			flow[parent[v]][v] += amount
+			flow[v][parent[v]] -= amount
+		}
+		sent += amount
+	}
+	if sent < total {
+		return nil, ErrNoValidSettlement
+	}
+
+	settlements := []SettlementTransaction{}
+	for i := range people {
+		for j := range people {
+			if flow[i][j] > 0 {
+				settlements = append(settlements, SettlementTransaction{FromUser: people[i], ToUser: people[j], Amount: flow[i][j]})
+			}
+		}
+	}
+	return settlements, nil
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"expensetracker/models"
+)
+
+// checkPlan fails the test unless transactions settle every balance using
+// only positive, allowed payments
+func checkPlan(t *testing.T, balances map[string]models.Money, transactions []SettlementTransaction, constraints *SettlementConstraints) {
+	t.Helper()
+	remaining := make(map[string]models.Money)
+	for userID, amount := range balances {
+		remaining[userID] = amount
+	}
+	for _, transaction := range transactions {
+		if transaction.Amount <= 0 {
+			t.Errorf("transfer %s -> %s of %v is not positive", transaction.FromUser, transaction.ToUser, transaction.Amount)
+		}
+		if !constraints.Allowed(transaction.FromUser, transaction.ToUser) {
+			t.Errorf("transfer %s -> %s is blocked", transaction.FromUser, transaction.ToUser)
+		}
+		remaining[transaction.FromUser] += transaction.Amount
+		remaining[transaction.ToUser] -= transaction.Amount
+	}
+	for userID, amount := range remaining {
+		if amount != 0 {
+			t.Errorf("%s is left with a balance of %v", userID, amount)
+		}
+	}
+}
+
+func TestZeroSumSubgroups(t *testing.T) {
+	tests := []struct {
+		name      string
+		balances  map[string]models.Money
+		subgroups int
+		remainder models.Money // Sum of the one subgroup allowed not to be zero-sum
+	}{
+		{"empty", map[string]models.Money{}, 0, 0},
+		{"only zero balances", map[string]models.Money{"a": 0, "b": 0}, 0, 0},
+		{"one subgroup", map[string]models.Money{"a": -3000, "b": 1000, "c": 2000}, 1, 0},
+		{"two pairs", map[string]models.Money{"a": -1000, "b": 1000, "c": -3000, "d": 3000}, 2, 0},
+		{"pair and triple", map[string]models.Money{"a": -1000, "b": 1000, "c": -500, "d": -2500, "e": 3000, "f": 0}, 2, 0},
+		{"pair and quadruple", map[string]models.Money{"a": 700, "b": 300, "c": -600, "d": -400, "e": 500, "f": -500}, 2, 0},
+		{"non-zero total", map[string]models.Money{"a": -1000, "b": 1000, "c": 500}, 2, 500},
+		{"non-zero total, two pairs", map[string]models.Money{"a": -1000, "b": 1000, "c": 500, "d": 2000, "e": -2000}, 3, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subgroups, ok := zeroSumSubgroups(tt.balances, 15)
+			if !ok {
+				t.Fatal("zeroSumSubgroups refused a small group")
+			}
+			if len(subgroups) != tt.subgroups {
+				t.Fatalf("got %d subgroups %v, want %d", len(subgroups), subgroups, tt.subgroups)
+			}
+
+			seen := map[string]bool{}
+			nonZero := 0
+			for _, subgroup := range subgroups {
+				var sum models.Money
+				for userID, amount := range subgroup {
+					if seen[userID] {
+						t.Errorf("%s is in more than one subgroup", userID)
+					}
+					if amount != tt.balances[userID] {
+						t.Errorf("%s has %v in a subgroup, want %v", userID, amount, tt.balances[userID])
+					}
+					seen[userID] = true
+					sum += amount
+				}
+				if sum != 0 {
+					nonZero++
+					if sum != tt.remainder {
+						t.Errorf("subgroup %v sums to %v, want %v", subgroup, sum, tt.remainder)
+					}
+				}
+			}
+			if tt.remainder != 0 && nonZero != 1 || tt.remainder == 0 && nonZero != 0 {
+				t.Errorf("got %d subgroups that do not sum to zero", nonZero)
+			}
+			for userID, amount := range tt.balances {
+				if amount != 0 && !seen[userID] {
+					t.Errorf("%s is missing from the subgroups", userID)
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateExactSettlements(t *testing.T) {
+	tests := []struct {
+		name      string
+		balances  map[string]models.Money
+		maxSize   int
+		transfers int
+		ok        bool
+	}{
+		{"settled group", map[string]models.Money{"a": 0, "b": 0}, 15, 0, true},
+		{"two pairs", map[string]models.Money{"a": -1000, "b": 1000, "c": -3000, "d": 3000}, 15, 2, true},
+		// Greedy pays the largest debt first and needs 5 transfers here
+		{"beats greedy", map[string]models.Money{"a": 700, "b": 300, "c": -600, "d": -400, "e": 500, "f": -500}, 15, 4, true},
+		{"at maxSize", map[string]models.Money{"a": -1000, "b": 1000, "c": -3000, "d": 3000}, 4, 2, true},
+		{"above maxSize", map[string]models.Money{"a": -1000, "b": 1000, "c": -3000, "d": 3000}, 3, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, ok := CalculateExactSettlements(tt.balances, tt.maxSize)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if len(transactions) != tt.transfers {
+				t.Errorf("got %d transfers %v, want %d", len(transactions), transactions, tt.transfers)
+			}
+			checkPlan(t, tt.balances, transactions, nil)
+		})
+	}
+}
+
+func TestSettleBalances(t *testing.T) {
+	balances := map[string]models.Money{"a": 700, "b": 300, "c": -600, "d": -400, "e": 500, "f": -500}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		maxSize   int
+		used      string
+		transfers int
+	}{
+		{"exact", AlgorithmExact, 15, AlgorithmExact, 4},
+		{"greedy when requested", AlgorithmGreedy, 15, AlgorithmGreedy, 5},
+		{"greedy above maxSize", AlgorithmExact, 5, AlgorithmGreedy, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, used, err := SettleBalances(balances, tt.algorithm, tt.maxSize, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if used != tt.used {
+				t.Errorf("used %q, want %q", used, tt.used)
+			}
+			if len(transactions) != tt.transfers {
+				t.Errorf("got %d transfers %v, want %d", len(transactions), transactions, tt.transfers)
+			}
+			checkPlan(t, balances, transactions, nil)
+		})
+	}
+}
+
+func blocked(pairs ...[2]string) *SettlementConstraints {
+	constraints := &SettlementConstraints{Blocked: map[string]map[string]bool{}}
+	for _, pair := range pairs {
+		if constraints.Blocked[pair[0]] == nil {
+			constraints.Blocked[pair[0]] = map[string]bool{}
+		}
+		constraints.Blocked[pair[0]][pair[1]] = true
+	}
+	return constraints
+}
+
+func TestSettleBalancesWithConstraints(t *testing.T) {
+	// a is owed by b, c and d
+	owedToA := map[string]models.Money{"a": 3000, "b": -1000, "c": -1000, "d": -1000}
+
+	tests := []struct {
+		name        string
+		balances    map[string]models.Money
+		algorithm   string
+		maxSize     int
+		constraints *SettlementConstraints
+		used        string
+		transfers   int
+		err         error
+	}{
+		{
+			name:      "blocked pair with a direct plan",
+			balances:  map[string]models.Money{"a": 1000, "b": 1000, "c": -1000, "d": -1000},
+			algorithm: AlgorithmExact, maxSize: 15,
+			constraints: blocked([2]string{"c", "a"}),
+			used:        AlgorithmExact, transfers: 2,
+		},
+		{
+			name:      "blocked pair in a larger group",
+			balances:  map[string]models.Money{"a": 700, "b": 300, "c": -600, "d": -400, "e": 500, "f": -500},
+			algorithm: AlgorithmExact, maxSize: 15,
+			constraints: blocked([2]string{"c", "e"}),
+			used:        AlgorithmExact, transfers: 4,
+		},
+		{
+			name:      "blocked pair forces a flow",
+			balances:  owedToA,
+			algorithm: AlgorithmExact, maxSize: 15,
+			constraints: blocked([2]string{"b", "a"}),
+			used:        AlgorithmFlow, transfers: 3,
+		},
+		{
+			name:      "flow through a settled member",
+			balances:  map[string]models.Money{"a": 1000, "b": -1000, "c": 0},
+			algorithm: AlgorithmExact, maxSize: 15,
+			constraints: blocked([2]string{"b", "a"}),
+			used:        AlgorithmFlow, transfers: 2,
+		},
+		{
+			name:      "no valid plan",
+			balances:  owedToA,
+			algorithm: AlgorithmExact, maxSize: 15,
+			constraints: blocked([2]string{"b", "a"}, [2]string{"c", "a"}, [2]string{"d", "a"}),
+			err:         ErrNoValidSettlement,
+		},
+		{
+			name:      "hub mode",
+			balances:  map[string]models.Money{"a": 1000, "b": 2000, "c": -1500, "d": -1500, "h": 0},
+			algorithm: AlgorithmExact, maxSize: 15,
+			constraints: &SettlementConstraints{Hub: "h"},
+			used:        AlgorithmHub, transfers: 4,
+		},
+		{
+			name:      "hub with a balance of its own",
+			balances:  owedToA,
+			algorithm: AlgorithmExact, maxSize: 15,
+			constraints: &SettlementConstraints{Hub: "b"},
+			used:        AlgorithmHub, transfers: 3,
+		},
+		{
+			name:      "hub that may not be paid",
+			balances:  owedToA,
+			algorithm: AlgorithmExact, maxSize: 15,
+			constraints: &SettlementConstraints{Hub: "a", Blocked: map[string]map[string]bool{"c": {"a": true}}},
+			err:         ErrNoValidSettlement,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, used, err := SettleBalances(tt.balances, tt.algorithm, tt.maxSize, tt.constraints)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if used != tt.used {
+				t.Errorf("used %q, want %q", used, tt.used)
+			}
+			if len(transactions) != tt.transfers {
+				t.Errorf("got %d transfers %v, want %d", len(transactions), transactions, tt.transfers)
+			}
+			checkPlan(t, tt.balances, transactions, tt.constraints)
+		})
+	}
+}
+
+func TestSettleBalancesPreferredPayees(t *testing.T) {
+	balances := map[string]models.Money{"a": 2000, "b": 1000, "c": -3000}
+	constraints := &SettlementConstraints{Preferred: map[string][]string{"c": {"b"}}}
+
+	transactions, _, err := SettleBalances(balances, AlgorithmGreedy, 15, constraints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPlan(t, balances, transactions, constraints)
+	if len(transactions) == 0 || transactions[0].ToUser != "b" {
+		t.Errorf("c should pay b first, got %v", transactions)
+	}
+}
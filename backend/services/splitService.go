@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"expensetracker/models"
+)
+
+// Supported split strategies for an expense
+const (
+	SplitEqual      = "equal"
+	SplitExact      = "exact"
+	SplitPercentage = "percentage"
+	SplitShares     = "shares"
+)
+
+// SplitInput is one participant of an expense together with the value
+// relevant for the chosen strategy (amount, percentage or shares)
+type SplitInput struct {
+	UserID     string
+	Amount     models.Money
+	Percentage float64
+	Shares     float64
+}
+
+// SplitResult is the amount a participant owes for an expense
+type SplitResult struct {
+	UserID string
+	Amount models.Money
+}
+
+// IsValidSplitType reports whether splitType is one of the supported strategies
+func IsValidSplitType(splitType string) bool {
+	switch splitType {
+	case SplitEqual, SplitExact, SplitPercentage, SplitShares:
+		return true
+	}
+	return false
+}
+
+// CalculateSplits divides total between the participants according to splitType
+// and validates that the resulting splits add up to the total. Equal, percentage
+// and share splits allocate leftover cents deterministically (see Money.Allocate),
+// so 100.00 split three ways is always 33.34/33.33/33.33.
+func CalculateSplits(splitType string, total models.Money, participants []SplitInput) ([]SplitResult, error) {
+	if len(participants) == 0 {
+		return nil, errors.New("at least one participant is required")
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range participants {
+		if seen[p.UserID] {
+			return nil, fmt.Errorf("participant %s is listed more than once", p.UserID)
+		}
+		seen[p.UserID] = true
+	}
+
+	weights := make([]int64, len(participants))
+
+	switch splitType {
+	case SplitEqual:
+		for i := range participants {
+			weights[i] = 1
+		}
+
+	case SplitExact:
+		var sum models.Money
+		results := make([]SplitResult, 0, len(participants))
+		for _, p := range participants {
+			if p.Amount < 0 {
+				return nil, fmt.Errorf("amount for participant %s cannot be negative", p.UserID)
+			}
+			sum += p.Amount
+			results = append(results, SplitResult{UserID: p.UserID, Amount: p.Amount})
+		}
+		if sum != total {
+			return nil, fmt.Errorf("split amounts add up to %s but the expense total is %s", sum, total)
+		}
+		return results, nil
+
+	case SplitPercentage:
+		// Percentages are compared in hundredths of a percent to stay exact
+		var sum int64
+		for i, p := range participants {
+			if p.Percentage < 0 {
+				return nil, fmt.Errorf("percentage for participant %s cannot be negative", p.UserID)
+			}
+			weights[i] = int64(math.Round(p.Percentage * 100))
+			sum += weights[i]
+		}
+		if sum != 100*100 {
+			return nil, fmt.Errorf("percentages add up to %.2f instead of 100", float64(sum)/100)
+		}
+
+	case SplitShares:
+		var sum int64
+		for i, p := range participants {
+			if p.Shares < 0 {
+				return nil, fmt.Errorf("shares for participant %s cannot be negative", p.UserID)
+			}
+			weights[i] = int64(math.Round(p.Shares * 100))
+			sum += weights[i]
+		}
+		if sum <= 0 {
+			return nil, errors.New("total shares must be greater than zero")
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported split type %q", splitType)
+	}
+
+	amounts, err := total.Allocate(weights)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SplitResult, len(participants))
+	for i, p := range participants {
+		results[i] = SplitResult{UserID: p.UserID, Amount: amounts[i]}
+	}
+	return results, nil
+}
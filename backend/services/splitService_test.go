@@ -0,0 +1,71 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"expensetracker/models"
+)
+
+func TestCalculateSplits(t *testing.T) {
+	three := func(a, b, c SplitInput) []SplitInput {
+		a.UserID, b.UserID, c.UserID = "a", "b", "c"
+		return []SplitInput{a, b, c}
+	}
+
+	tests := []struct {
+		name         string
+		splitType    string
+		total        models.Money
+		participants []SplitInput
+		want         []models.Money
+		ok           bool
+	}{
+		{"equal", SplitEqual, 9000, three(SplitInput{}, SplitInput{}, SplitInput{}), []models.Money{3000, 3000, 3000}, true},
+		{"equal with remainder cents", SplitEqual, 10000, three(SplitInput{}, SplitInput{}, SplitInput{}), []models.Money{3334, 3333, 3333}, true},
+		{"equal cent", SplitEqual, 1, three(SplitInput{}, SplitInput{}, SplitInput{}), []models.Money{1, 0, 0}, true},
+		{"exact", SplitExact, 6000, three(SplitInput{Amount: 1000}, SplitInput{Amount: 2000}, SplitInput{Amount: 3000}), []models.Money{1000, 2000, 3000}, true},
+		{"exact short of the total", SplitExact, 6000, three(SplitInput{Amount: 1000}, SplitInput{Amount: 2000}, SplitInput{Amount: 2999}), nil, false},
+		{"exact negative", SplitExact, 0, three(SplitInput{Amount: 1000}, SplitInput{Amount: -1000}, SplitInput{}), nil, false},
+		{"percentage", SplitPercentage, 10000, three(SplitInput{Percentage: 50}, SplitInput{Percentage: 30}, SplitInput{Percentage: 20}), []models.Money{5000, 3000, 2000}, true},
+		{"percentage with remainder cents", SplitPercentage, 100, three(SplitInput{Percentage: 33.33}, SplitInput{Percentage: 33.33}, SplitInput{Percentage: 33.34}), []models.Money{33, 33, 34}, true},
+		{"percentage thirds of a cent", SplitPercentage, 1000, three(SplitInput{Percentage: 33.33}, SplitInput{Percentage: 33.33}, SplitInput{Percentage: 33.34}), []models.Money{333, 333, 334}, true},
+		{"percentages under 100", SplitPercentage, 10000, three(SplitInput{Percentage: 50}, SplitInput{Percentage: 30}, SplitInput{Percentage: 19.99}), nil, false},
+		{"percentages over 100", SplitPercentage, 10000, three(SplitInput{Percentage: 50}, SplitInput{Percentage: 30}, SplitInput{Percentage: 21}), nil, false},
+		{"negative percentage", SplitPercentage, 10000, three(SplitInput{Percentage: 120}, SplitInput{Percentage: -20}, SplitInput{}), nil, false},
+		{"shares", SplitShares, 6000, three(SplitInput{Shares: 1}, SplitInput{Shares: 2}, SplitInput{Shares: 3}), []models.Money{1000, 2000, 3000}, true},
+		{"shares with remainder cents", SplitShares, 1000, three(SplitInput{Shares: 1}, SplitInput{Shares: 1}, SplitInput{Shares: 1}), []models.Money{334, 333, 333}, true},
+		{"fractional shares", SplitShares, 1000, three(SplitInput{Shares: 0.5}, SplitInput{Shares: 1.5}, SplitInput{}), []models.Money{250, 750, 0}, true},
+		{"no shares", SplitShares, 1000, three(SplitInput{}, SplitInput{}, SplitInput{}), nil, false},
+		{"unknown type", "halves", 1000, three(SplitInput{}, SplitInput{}, SplitInput{}), nil, false},
+		{"no participants", SplitEqual, 1000, nil, nil, false},
+		{"duplicate participant", SplitEqual, 1000, []SplitInput{{UserID: "a"}, {UserID: "a"}}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := CalculateSplits(tt.splitType, tt.total, tt.participants)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error = %v, want ok = %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+
+			var got []models.Money
+			var sum models.Money
+			for i, result := range results {
+				if result.UserID != tt.participants[i].UserID {
+					t.Errorf("result %d is for %s, want %s", i, result.UserID, tt.participants[i].UserID)
+				}
+				got = append(got, result.Amount)
+				sum += result.Amount
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if sum != tt.total {
+				t.Errorf("splits add up to %v, want %v", sum, tt.total)
+			}
+		})
+	}
+}
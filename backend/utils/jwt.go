@@ -1,23 +1,96 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func GenerateJWT(userID string) (string, error) {
+const (
+	// AccessTokenTTL is how long a JWT access token is valid
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token can be exchanged for a new pair
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// InviteTokenTTL is how long a group invitation can be accepted
+	InviteTokenTTL = 7 * 24 * time.Hour
+)
+
+// GenerateJWT issues a short-lived access token. Every token carries a unique
+// jti so it can be revoked before it expires; the jti and expiry are returned
+// alongside the signed token.
+func GenerateJWT(userID string) (string, string, time.Time, error) {
 	secretKey := []byte(os.Getenv("JWT_SECRET"))
-	
+
+	tokenID := primitive.NewObjectID().Hex()
+	expiresAt := time.Now().Add(AccessTokenTTL)
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
+		"jti":     tokenID,
+		"type":    "access",
+		"exp":     expiresAt.Unix(),
 	})
 
 	tokenString, err := token.SignedString(secretKey)
 	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return tokenString, tokenID, expiresAt, nil
+}
+
+// GenerateRefreshToken returns a random opaque refresh token. Only its hash
+// (see HashToken) is stored server-side.
+func GenerateRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
 		return "", err
 	}
-	return tokenString, nil
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the SHA-256 hex digest under which a token is stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateInviteToken signs an invitation token for the given invitation ID
+func GenerateInviteToken(invitationID string, expiresAt time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"invite_id": invitationID,
+		"type":      "invite",
+		"exp":       expiresAt.Unix(),
+	})
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// ParseInviteToken verifies an invitation token and returns the invitation ID
+func ParseInviteToken(tokenString string) (string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+	if err != nil || !token.Valid {
+		return "", errors.New("invalid or expired invitation")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["type"] != "invite" {
+		return "", errors.New("invalid invitation")
+	}
+	invitationID, _ := claims["invite_id"].(string)
+	if invitationID == "" {
+		return "", errors.New("invalid invitation")
+	}
+	return invitationID, nil
 }
@@ -22,6 +22,7 @@ export const AuthProvider = ({ children }) => {
     const login = async (email, password) => {
         const response = await api.post('/auth/login', { email, password });
         localStorage.setItem('token', response.data.token);
+        localStorage.setItem('refreshToken', response.data.refreshToken);
         localStorage.setItem('user', JSON.stringify(response.data.user));
         setUser(response.data.user);
         return response.data;
@@ -32,8 +33,14 @@ export const AuthProvider = ({ children }) => {
         return response.data;
     };
 
-    const logout = () => {
+    const logout = async () => {
+        try {
+            await api.post('/auth/logout', { refreshToken: localStorage.getItem('refreshToken') });
+        } catch {
+            // The session is cleared locally even if the server is unreachable
+        }
         localStorage.removeItem('token');
+        localStorage.removeItem('refreshToken');
         localStorage.removeItem('user');
         setUser(null);
     };
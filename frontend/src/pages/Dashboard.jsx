@@ -48,8 +48,8 @@ const Dashboard = () => {
         fetchDashboardData();
     }, []);
 
-    const handleLogout = () => {
-        logout();
+    const handleLogout = async () => {
+        await logout();
         navigate('/login');
     };
 
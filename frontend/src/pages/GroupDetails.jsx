@@ -10,6 +10,8 @@ const GroupDetails = () => {
     const [group, setGroup] = useState(null);
     const [settlements, setSettlements] = useState([]);
     const [expenses, setExpenses] = useState([]);
+    const [nextCursor, setNextCursor] = useState(null);
+    const [loadingMore, setLoadingMore] = useState(false);
     const [loading, setLoading] = useState(true);
 
     // Form states
@@ -30,7 +32,8 @@ const GroupDetails = () => {
 
                 setGroup(groupRes.data);
                 setSettlements(settlementRes.data.transactions || []);
-                setExpenses(expenseRes.data || []);
+                setExpenses(expenseRes.data.expenses || []);
+                setNextCursor(expenseRes.data.nextCursor);
                 setLoading(false);
             } catch (err) {
                 console.error("Failed to fetch group details", err);
@@ -40,6 +43,20 @@ const GroupDetails = () => {
         fetchData();
     }, [id, user]);
 
+    // Expenses come one page at a time; fetch the page after the last one shown
+    const handleLoadMore = async () => {
+        setLoadingMore(true);
+        try {
+            const res = await api.get(`/expenses/${id}`, { params: { cursor: nextCursor } });
+            setExpenses(prev => [...prev, ...(res.data.expenses || [])]);
+            setNextCursor(res.data.nextCursor);
+        } catch (err) {
+            console.error("Failed to fetch more expenses", err);
+        } finally {
+            setLoadingMore(false);
+        }
+    };
+
     const handleAddExpense = async (e) => {
         e.preventDefault();
         try {
@@ -138,6 +155,15 @@ const GroupDetails = () => {
                                 ))}
                             </ul>
                         )}
+                        {nextCursor && (
+                            <button
+                                onClick={handleLoadMore}
+                                disabled={loadingMore}
+                                className="w-full mt-4 py-2 font-medium text-blue-600 hover:bg-slate-50 rounded-lg disabled:opacity-50"
+                            >
+                                {loadingMore ? 'Loading...' : 'Load more'}
+                            </button>
+                        )}
                     </div>
                 </div>
 
@@ -168,6 +194,15 @@ const GroupDetails = () => {
                                 ))}
                             </ul>
                         )}
+                        {nextCursor && (
+                            <button
+                                onClick={handleLoadMore}
+                                disabled={loadingMore}
+                                className="w-full mt-4 py-2 font-medium text-blue-600 hover:bg-slate-50 rounded-lg disabled:opacity-50"
+                            >
+                                {loadingMore ? 'Loading...' : 'Load more'}
+                            </button>
+                        )}
                     </div>
                 </div>
 
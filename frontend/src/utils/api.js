@@ -15,4 +15,48 @@ api.interceptors.request.use(
     (error) => Promise.reject(error)
 );
 
+// One refresh at a time: requests failing together share the pending refresh,
+// since presenting an already rotated refresh token revokes the whole session
+let pendingRefresh = null;
+
+const refreshTokens = (refreshToken) => {
+    if (!pendingRefresh) {
+        pendingRefresh = api.post('/auth/refresh', { refreshToken })
+            .then((response) => {
+                localStorage.setItem('token', response.data.token);
+                localStorage.setItem('refreshToken', response.data.refreshToken);
+            })
+            .catch((refreshError) => {
+                localStorage.removeItem('token');
+                localStorage.removeItem('refreshToken');
+                localStorage.removeItem('user');
+                throw refreshError;
+            })
+            .finally(() => {
+                pendingRefresh = null;
+            });
+    }
+    return pendingRefresh;
+};
+
+// On a 401, exchange the refresh token for a new pair once and replay the request
+api.interceptors.response.use(
+    (response) => response,
+    async (error) => {
+        const original = error.config;
+        const refreshToken = localStorage.getItem('refreshToken');
+        if (error.response?.status !== 401 || !refreshToken || original._retried || original.url === '/auth/refresh') {
+            return Promise.reject(error);
+        }
+        original._retried = true;
+
+        // Sent with a token that has been refreshed since: just replay it
+        if (original.headers['Authorization'] !== `Bearer ${localStorage.getItem('token')}`) {
+            return api(original);
+        }
+        await refreshTokens(refreshToken);
+        return api(original);
+    }
+);
+
 export default api;